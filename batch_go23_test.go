@@ -0,0 +1,349 @@
+//go:build go1.23
+
+package sync_map_test
+
+import (
+	"iter"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"testing/quick"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+func TestMapLoadMany(t *testing.T) {
+	m := sync_map.NewMap[string, int](sync_map.WithStats())
+	m.Store("read", 1)
+	m.Store("deleted", 2)
+	m.Promote()
+	m.Delete("deleted")
+	m.Store("dirty1", 3)
+	m.Store("dirty2", 4)
+
+	keys := []string{"read", "deleted", "dirty1", "missing", "dirty2", "read"}
+	out := make([]int, len(keys))
+	for i := range out {
+		out[i] = -1
+	}
+	before := m.Stats().SlowPaths.Load
+	found := m.LoadMany(keys, out)
+	// The keys missing from the read map share one acquisition of the lock.
+	if got := m.Stats().SlowPaths.Load - before; got != 1 {
+		t.Errorf("LoadMany locked the map %v times; want 1", got)
+	}
+
+	for i, key := range keys {
+		v, ok := m.Load(key)
+		if out[i] != v || found[i] != ok {
+			t.Errorf("LoadMany for %q = %v, %v; Load returned %v, %v", key, out[i], found[i], v, ok)
+		}
+	}
+	if want := []bool{true, false, true, false, true, true}; !reflect.DeepEqual(found, want) {
+		t.Errorf("LoadMany found %v; want %v", found, want)
+	}
+}
+
+func TestMapLoadManyShortOut(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("LoadMany with a short out slice did not panic")
+		}
+	}()
+	var m sync_map.Map[int, int]
+	m.LoadMany([]int{1, 2}, make([]int, 1))
+}
+
+func TestMapStoreManyDeleteMany(t *testing.T) {
+	const n = 600
+	stored := 0
+	m := sync_map.NewMap[int, int](sync_map.WithStats(), sync_map.WithHooks(sync_map.Hooks[int, int]{
+		OnStore: func(int, int, bool, int) { stored++ },
+	}))
+	m.Store(0, -1)
+	m.Promote() // Move key 0 to the read map, so that it is stored without locking.
+
+	m.StoreMany(func(yield func(int, int) bool) {
+		for k := 0; k < n; k++ {
+			if !yield(k, k) {
+				return
+			}
+		}
+		// Later stores of the same key win.
+		yield(1, 100)
+	})
+	if m.Len() != n {
+		t.Errorf("after StoreMany, Len() = %v; want %v", m.Len(), n)
+	}
+	if stored != n+2 {
+		t.Errorf("StoreMany called OnStore %v times; want %v", stored, n+2)
+	}
+	for k := 0; k < n; k++ {
+		want := k
+		if k == 1 {
+			want = 100
+		}
+		if v, ok := m.Load(k); !ok || v != want {
+			t.Fatalf("after StoreMany, Load(%v) = %v, %v; want %v, true", k, v, ok, want)
+		}
+	}
+	// The n-1 new keys are stored in batches, each locking the map once.
+	if got, want := m.Stats().SlowPaths.Swap, uint64(1+(n-1+255)/256); got != want {
+		t.Errorf("StoreMany locked the map %v times; want %v", got, want)
+	}
+
+	m.Store(n, n) // Leave a key in the dirty map only.
+	m.DeleteMany(func(yield func(int) bool) {
+		for k := 0; k <= n+1; k += 2 {
+			if !yield(k) {
+				return
+			}
+		}
+	})
+	for k := 0; k <= n; k++ {
+		_, ok := m.Load(k)
+		if want := k%2 == 1; ok != want {
+			t.Fatalf("after DeleteMany, Load(%v) found = %v; want %v", k, ok, want)
+		}
+	}
+	if m.Len() != n/2 {
+		t.Errorf("after DeleteMany, Len() = %v; want %v", m.Len(), n/2)
+	}
+}
+
+func TestMapStoreManyDeleteManyMatchesMap(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var m sync_map.Map[int, int]
+	want := map[int]int{}
+	for round := 0; round < 100; round++ {
+		keys := make([]int, r.Intn(600))
+		for i := range keys {
+			keys[i] = r.Intn(1000)
+		}
+		if r.Intn(2) == 0 {
+			m.StoreMany(func(yield func(int, int) bool) {
+				for i, k := range keys {
+					if !yield(k, round*1000+i) {
+						return
+					}
+				}
+			})
+			for i, k := range keys {
+				want[k] = round*1000 + i
+			}
+		} else {
+			m.DeleteMany(func(yield func(int) bool) {
+				for _, k := range keys {
+					if !yield(k) {
+						return
+					}
+				}
+			})
+			for _, k := range keys {
+				delete(want, k)
+			}
+		}
+		if r.Intn(4) == 0 {
+			m.Load(-1) // Record a miss, which may promote the dirty map.
+		}
+		if got := mapContents(&m); !reflect.DeepEqual(got, want) {
+			t.Fatalf("round %d: map holds %v; want %v", round, got, want)
+		}
+		if m.Len() != len(want) {
+			t.Fatalf("round %d: Len() = %v; want %v", round, m.Len(), len(want))
+		}
+	}
+}
+
+func TestConcurrentStoreMany(t *testing.T) {
+	const goroutines, perG = 4, 1000
+	var m sync_map.Map[int, int]
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			m.StoreMany(func(yield func(int, int) bool) {
+				for i := 0; i < perG; i++ {
+					k := g*perG + i
+					if !yield(k, k) {
+						return
+					}
+					// The iterator may call methods on the map.
+					m.Load(k)
+				}
+			})
+			m.DeleteMany(func(yield func(int) bool) {
+				for i := 0; i < perG; i += 2 {
+					if !yield(g*perG + i) {
+						return
+					}
+				}
+			})
+		}(g)
+	}
+	wg.Wait()
+	if m.Len() != goroutines*perG/2 {
+		t.Errorf("Len() = %v; want %v", m.Len(), goroutines*perG/2)
+	}
+}
+
+// batchMapInterface is the interface used to check StoreMany and DeleteMany.
+type batchMapInterface interface {
+	Load(key any) (value any, ok bool)
+	Store(key, value any)
+	Delete(any)
+	StoreMany(seq iter.Seq2[any, any])
+	DeleteMany(keys iter.Seq[any])
+	Range(func(key, value any) (shouldContinue bool))
+}
+
+var _ batchMapInterface = &CasMap[any, any]{}
+
+func (m *RWMutexMap) StoreMany(seq iter.Seq2[any, any]) {
+	for k, v := range seq {
+		m.Store(k, v)
+	}
+}
+
+func (m *RWMutexMap) DeleteMany(keys iter.Seq[any]) {
+	for k := range keys {
+		m.Delete(k)
+	}
+}
+
+const (
+	opStoreMany  = mapOp("StoreMany")
+	opDeleteMany = mapOp("DeleteMany")
+)
+
+var batchOps = [...]mapOp{
+	opLoad,
+	opStore,
+	opDelete,
+	opStoreMany,
+	opDeleteMany,
+}
+
+// batchCall is a quick.Generator for calls on batchMapInterface. Single-key
+// calls use the first key and value.
+type batchCall struct {
+	op   mapOp
+	k, v []any
+}
+
+func (batchCall) Generate(r *rand.Rand, size int) reflect.Value {
+	c := batchCall{op: batchOps[rand.Intn(len(batchOps))]}
+	n := 1
+	if c.op == opStoreMany || c.op == opDeleteMany {
+		n = r.Intn(size + 1)
+	}
+	for i := 0; i < n; i++ {
+		c.k = append(c.k, randValue(r))
+		c.v = append(c.v, randValue(r))
+	}
+	return reflect.ValueOf(c)
+}
+
+func (c batchCall) apply(m batchMapInterface) (any, bool) {
+	switch c.op {
+	case opLoad:
+		return m.Load(c.k[0])
+	case opStore:
+		m.Store(c.k[0], c.v[0])
+		return nil, false
+	case opDelete:
+		m.Delete(c.k[0])
+		return nil, false
+	case opStoreMany:
+		m.StoreMany(func(yield func(any, any) bool) {
+			for i, k := range c.k {
+				if !yield(k, c.v[i]) {
+					return
+				}
+				runtime.Gosched() // Let the concurrent Loads run mid-batch.
+			}
+		})
+		return nil, false
+	case opDeleteMany:
+		m.DeleteMany(func(yield func(any) bool) {
+			for _, k := range c.k {
+				if !yield(k) {
+					return
+				}
+				runtime.Gosched()
+			}
+		})
+		return nil, false
+	default:
+		panic("invalid mapOp")
+	}
+}
+
+// applyBatchCalls applies calls to m while another goroutine loads the keys
+// they touch. It reports, as the last result, whether every concurrent Load
+// returned a value that had been stored for its key.
+func applyBatchCalls(m batchMapInterface, calls []batchCall) (results []mapResult, final map[any]any) {
+	stored := make(map[any]map[any]bool)
+	var keys []any
+	for _, c := range calls {
+		for i, k := range c.k {
+			if stored[k] == nil {
+				stored[k] = make(map[any]bool)
+				keys = append(keys, k)
+			}
+			if c.op == opStore || c.op == opStoreMany {
+				stored[k][c.v[i]] = true
+			}
+		}
+	}
+
+	done := make(chan struct{})
+	consistent := true
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; len(keys) > 0; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			k := keys[i%len(keys)]
+			if v, ok := m.Load(k); ok && !stored[k][v] {
+				consistent = false
+			}
+			runtime.Gosched()
+		}
+	}()
+	for _, c := range calls {
+		v, ok := c.apply(m)
+		results = append(results, mapResult{v, ok})
+	}
+	close(done)
+	wg.Wait()
+	results = append(results, mapResult{nil, consistent})
+
+	final = make(map[any]any)
+	m.Range(func(k, v any) bool {
+		final[k] = v
+		return true
+	})
+
+	return results, final
+}
+
+func TestBatchMatchesRWMutex(t *testing.T) {
+	applyMap := func(calls []batchCall) ([]mapResult, map[any]any) {
+		return applyBatchCalls(new(CasMap[any, any]), calls)
+	}
+	applyRWMutexMap := func(calls []batchCall) ([]mapResult, map[any]any) {
+		return applyBatchCalls(new(RWMutexMap), calls)
+	}
+	if err := quick.CheckEqual(applyMap, applyRWMutexMap, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,283 @@
+package sync_map
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// BoundedMap is like a [Map], but holds at most a fixed number of entries.
+// Storing a new key in a full BoundedMap evicts another entry, chosen by the
+// CLOCK (second-chance) approximation of least-recently-used.
+//
+// Loads keep the lock-free fast path of Map: a hit only sets the entry's
+// reference bit, if it is not already set. Storing a key that is already
+// present is also lock-free. Only adding and deleting keys lock the map,
+// which is when the clock hand sweeps the entries, clearing reference bits,
+// until it finds one that has not been loaded since the last sweep to evict.
+//
+// The zero BoundedMap is not usable; create one with [NewBoundedMap].
+// A BoundedMap must not be copied after first use.
+type BoundedMap[K comparable, V any] struct {
+	m        Map[K, *boundedEntry[K, V]]
+	capacity int
+	onEvict  func(key K, value V)
+
+	mu   sync.Mutex // guards adding and deleting keys, and the fields below
+	ring []*boundedEntry[K, V]
+	hand int
+
+	evictions atomic.Uint64
+
+	// lookups counts hits and misses, or is nil if the map was not created
+	// with WithHitStats. It is allocated separately so that loads do not
+	// contend with the fields above.
+	lookups *boundedLookups
+}
+
+type boundedLookups struct {
+	hits, misses atomic.Uint64
+}
+
+type boundedEntry[K comparable, V any] struct {
+	key  K
+	p    atomic.Pointer[V]
+	ref  atomic.Bool
+	slot int // index in ring, guarded by mu
+}
+
+// touch marks e as recently used. It avoids writing to e if e is already
+// marked, so that loads of a hot key do not contend on its cache line.
+func (e *boundedEntry[K, V]) touch() {
+	if !e.ref.Load() {
+		e.ref.Store(true)
+	}
+}
+
+// BoundedStats reports the cumulative counters of a [BoundedMap].
+type BoundedStats struct {
+	// Hits and Misses count the calls to Load and LoadOrStore that did and
+	// did not find their key. They are only maintained by maps created with
+	// the [WithHitStats] option; they are zero otherwise.
+	Hits   uint64
+	Misses uint64
+	// Evictions counts the entries evicted to make room for new keys.
+	Evictions uint64
+}
+
+// A BoundedOption configures a BoundedMap created by [NewBoundedMap].
+type BoundedOption func(*boundedOptions)
+
+type boundedOptions struct {
+	hitStats bool
+}
+
+// WithHitStats makes the BoundedMap count the hits and misses reported by
+// [BoundedMap.Stats].
+//
+// Every call to Load and LoadOrStore then updates a counter shared by all
+// goroutines, which limits how well loads scale across CPUs.
+func WithHitStats() BoundedOption {
+	return func(o *boundedOptions) {
+		o.hitStats = true
+	}
+}
+
+// NewBoundedMap returns an empty BoundedMap that holds at most capacity
+// entries. NewBoundedMap panics if capacity < 1.
+//
+// If onEvict is not nil, it is called with each entry evicted to make room
+// for a new key, after the entry has been removed, by the goroutine whose
+// store caused the eviction. It is not called for entries removed by Delete
+// or LoadAndDelete.
+func NewBoundedMap[K comparable, V any](capacity int, onEvict func(key K, value V), opts ...BoundedOption) *BoundedMap[K, V] {
+	if capacity < 1 {
+		panic("sync_map: NewBoundedMap with capacity < 1")
+	}
+	var o boundedOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	b := &BoundedMap[K, V]{
+		capacity: capacity,
+		onEvict:  onEvict,
+	}
+	if o.hitStats {
+		b.lookups = new(boundedLookups)
+	}
+	return b
+}
+
+// Load returns the value stored in the map for a key, or the zero value if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (b *BoundedMap[K, V]) Load(key K) (value V, ok bool) {
+	e, ok := b.m.Load(key)
+	b.countLookup(ok)
+	if !ok {
+		return value, false
+	}
+	e.touch()
+	return *e.p.Load(), true
+}
+
+// Store sets the value for a key, evicting another entry if the key is new
+// and the map is full.
+//
+// A Store that races with the eviction of its key may be lost, as if the
+// entry had been evicted just after it.
+func (b *BoundedMap[K, V]) Store(key K, value V) {
+	if e, ok := b.m.Load(key); ok {
+		e.p.Store(&value)
+		e.touch()
+		return
+	}
+	b.add(key, value, false)
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value, evicting another entry if
+// the map is full.
+// The loaded result is true if the value was loaded, false if stored.
+func (b *BoundedMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	e, ok := b.m.Load(key)
+	b.countLookup(ok)
+	if ok {
+		e.touch()
+		return *e.p.Load(), true
+	}
+	return b.add(key, value, true)
+}
+
+// countLookup counts a hit or a miss, if the map counts them.
+func (b *BoundedMap[K, V]) countLookup(hit bool) {
+	switch {
+	case b.lookups == nil:
+	case hit:
+		b.lookups.hits.Add(1)
+	default:
+		b.lookups.misses.Add(1)
+	}
+}
+
+// add adds a new key to the map. If the key has been added concurrently,
+// add instead loads its value if keep is set, or stores value otherwise.
+func (b *BoundedMap[K, V]) add(key K, value V, keep bool) (actual V, loaded bool) {
+	e := &boundedEntry[K, V]{key: key}
+	e.p.Store(&value)
+
+	b.mu.Lock()
+	if old, loaded := b.m.LoadOrStore(key, e); loaded {
+		b.mu.Unlock()
+		if keep {
+			return *old.p.Load(), true
+		}
+		old.p.Store(&value)
+		old.touch()
+		return value, false
+	}
+
+	var victim *boundedEntry[K, V]
+	if len(b.ring) < b.capacity {
+		e.slot = len(b.ring)
+		b.ring = append(b.ring, e)
+	} else {
+		victim = b.evictLocked()
+		e.slot = victim.slot
+		b.ring[e.slot] = e
+	}
+	b.mu.Unlock()
+
+	if victim != nil {
+		b.evictions.Add(1)
+		if b.onEvict != nil {
+			b.onEvict(victim.key, *victim.p.Load())
+		}
+	}
+	return value, false
+}
+
+// evictLocked advances the clock hand to an entry that has not been
+// referenced since the hand last passed it, and removes that entry from the
+// map. The caller must reuse its slot in the ring.
+func (b *BoundedMap[K, V]) evictLocked() *boundedEntry[K, V] {
+	for {
+		e := b.ring[b.hand]
+		b.hand++
+		if b.hand == len(b.ring) {
+			b.hand = 0
+		}
+		if e.ref.Load() {
+			e.ref.Store(false)
+			continue
+		}
+		b.m.Delete(e.key)
+		return e
+	}
+}
+
+// removeLocked removes e from the ring, moving the last entry into its slot.
+func (b *BoundedMap[K, V]) removeLocked(e *boundedEntry[K, V]) {
+	last := len(b.ring) - 1
+	b.ring[e.slot] = b.ring[last]
+	b.ring[e.slot].slot = e.slot
+	b.ring[last] = nil
+	b.ring = b.ring[:last]
+	if b.hand >= last {
+		b.hand = 0
+	}
+}
+
+// Delete deletes the value for a key.
+func (b *BoundedMap[K, V]) Delete(key K) {
+	b.LoadAndDelete(key)
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if
+// any. The loaded result reports whether the key was present.
+func (b *BoundedMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	if _, ok := b.m.Load(key); !ok {
+		return value, false
+	}
+	b.mu.Lock()
+	e, loaded := b.m.LoadAndDelete(key)
+	if loaded {
+		b.removeLocked(e)
+	}
+	b.mu.Unlock()
+	if !loaded {
+		return value, false
+	}
+	return *e.p.Load(), true
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// Range has the same semantics as [Map.Range]. It does not mark the entries
+// it visits as recently used.
+func (b *BoundedMap[K, V]) Range(f func(key K, value V) bool) {
+	b.m.Range(func(key K, e *boundedEntry[K, V]) bool {
+		return f(key, *e.p.Load())
+	})
+}
+
+// Len returns the number of entries in the map. See [Map.Len].
+func (b *BoundedMap[K, V]) Len() int {
+	return b.m.Len()
+}
+
+// Cap returns the maximum number of entries in the map.
+func (b *BoundedMap[K, V]) Cap() int {
+	return b.capacity
+}
+
+// Stats returns the map's hit, miss and eviction counters. See
+// [WithHitStats].
+func (b *BoundedMap[K, V]) Stats() BoundedStats {
+	s := BoundedStats{Evictions: b.evictions.Load()}
+	if b.lookups != nil {
+		s.Hits = b.lookups.hits.Load()
+		s.Misses = b.lookups.misses.Load()
+	}
+	return s
+}
@@ -0,0 +1,155 @@
+package sync_map_test
+
+import (
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+func boundedContents[K comparable, V any](b *sync_map.BoundedMap[K, V]) map[K]V {
+	contents := map[K]V{}
+	b.Range(func(k K, v V) bool {
+		contents[k] = v
+		return true
+	})
+	return contents
+}
+
+func TestBoundedMapEvictsUnreferenced(t *testing.T) {
+	evicted := map[string]int{}
+	b := sync_map.NewBoundedMap[string, int](3, func(k string, v int) {
+		evicted[k] = v
+	})
+	b.Store("a", 1)
+	b.Store("b", 2)
+	b.Store("c", 3)
+	b.Load("a")
+	b.Load("c")
+
+	// The hand clears a's reference bit and evicts b, the only entry that
+	// has not been loaded.
+	b.Store("d", 4)
+	if want := map[string]int{"b": 2}; !reflect.DeepEqual(evicted, want) {
+		t.Errorf("storing d evicted %v; want %v", evicted, want)
+	}
+	if got, want := boundedContents(b), map[string]int{"a": 1, "c": 3, "d": 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after storing d, map holds %v; want %v", got, want)
+	}
+
+	// Storing an existing key never evicts.
+	b.Store("a", 5)
+	if len(evicted) != 1 {
+		t.Errorf("storing an existing key evicted an entry: %v", evicted)
+	}
+
+	// Deleting makes room without evicting.
+	b.Delete("c")
+	b.Store("e", 6)
+	if len(evicted) != 1 {
+		t.Errorf("storing into a map with room evicted an entry: %v", evicted)
+	}
+	if got, want := boundedContents(b), map[string]int{"a": 5, "d": 4, "e": 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after deleting c and storing e, map holds %v; want %v", got, want)
+	}
+}
+
+func TestBoundedMapLoadOrStore(t *testing.T) {
+	b := sync_map.NewBoundedMap[int, int](2, nil)
+	if actual, loaded := b.LoadOrStore(1, 10); loaded || actual != 10 {
+		t.Errorf("LoadOrStore of new key = %v, %v; want 10, false", actual, loaded)
+	}
+	if actual, loaded := b.LoadOrStore(1, 20); !loaded || actual != 10 {
+		t.Errorf("LoadOrStore of present key = %v, %v; want 10, true", actual, loaded)
+	}
+	if v, loaded := b.LoadAndDelete(1); !loaded || v != 10 {
+		t.Errorf("LoadAndDelete = %v, %v; want 10, true", v, loaded)
+	}
+	if _, loaded := b.LoadAndDelete(1); loaded {
+		t.Errorf("LoadAndDelete of deleted key reported loaded = true")
+	}
+}
+
+func TestBoundedMapStats(t *testing.T) {
+	b := sync_map.NewBoundedMap[int, int](2, nil, sync_map.WithHitStats())
+	b.Store(1, 1)
+	b.Load(1)
+	b.Load(2)
+	b.LoadOrStore(1, 1)
+	b.LoadOrStore(2, 2)
+	b.Store(3, 3)
+	b.Store(4, 4)
+
+	want := sync_map.BoundedStats{Hits: 2, Misses: 2, Evictions: 2}
+	if got := b.Stats(); got != want {
+		t.Errorf("Stats() = %+v; want %+v", got, want)
+	}
+	if b.Len() != 2 || b.Cap() != 2 {
+		t.Errorf("Len(), Cap() = %v, %v; want 2, 2", b.Len(), b.Cap())
+	}
+
+	// Without WithHitStats, only evictions are counted.
+	b = sync_map.NewBoundedMap[int, int](1, nil)
+	b.Store(1, 1)
+	b.Load(1)
+	b.Load(2)
+	b.Store(2, 2)
+	want = sync_map.BoundedStats{Evictions: 1}
+	if got := b.Stats(); got != want {
+		t.Errorf("without WithHitStats, Stats() = %+v; want %+v", got, want)
+	}
+}
+
+func TestBoundedMapConcurrent(t *testing.T) {
+	const capacity = 64
+	var evictions sync.Map
+	b := sync_map.NewBoundedMap[int, int](capacity, func(k, v int) {
+		if k != v {
+			t.Errorf("evicted %v with value %v", k, v)
+		}
+		evictions.Store(k, true)
+	})
+
+	var wg sync.WaitGroup
+	for g := 0; g < runtime.GOMAXPROCS(0); g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < 10000; i++ {
+				k := r.Intn(4 * capacity)
+				switch r.Intn(4) {
+				case 0:
+					b.Store(k, k)
+				case 1:
+					b.LoadOrStore(k, k)
+				case 2:
+					b.Delete(k)
+				default:
+					if v, ok := b.Load(k); ok && v != k {
+						t.Errorf("Load(%v) = %v", k, v)
+					}
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+
+	contents := boundedContents(b)
+	if len(contents) > capacity {
+		t.Errorf("map holds %v entries; want at most %v", len(contents), capacity)
+	}
+	if b.Len() != len(contents) {
+		t.Errorf("Len() = %v, but Range visited %v entries", b.Len(), len(contents))
+	}
+	// The map must still be able to fill up to capacity.
+	for k := 1000; k < 1000+capacity; k++ {
+		b.Store(k, k)
+	}
+	if b.Len() != capacity {
+		t.Errorf("after storing %v new keys, Len() = %v; want %v", capacity, b.Len(), capacity)
+	}
+}
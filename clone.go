@@ -0,0 +1,152 @@
+package sync_map
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// Snapshot returns a copy of the contents of the map at a single instant.
+//
+// Unlike [Map.Range], Snapshot is linearizable: the result is the contents of
+// the map at some point during the call, consistent with every operation that
+// completes before it starts or starts after it returns. Loads and updates of
+// present keys usually proceed during a Snapshot, but operations that add
+// keys, and operations on keys deleted since the map last copied its read map,
+// block until it returns. If concurrent updates keep changing the map,
+// Snapshot blocks every operation on it until it returns, so Snapshot should
+// not be called on a hot path.
+func (m *Map[K, V]) Snapshot() map[K]V {
+	ptrs := m.freeze()
+	snap := make(map[K]V, len(ptrs))
+	for k, p := range ptrs {
+		snap[k] = *(*V)(p)
+	}
+	return snap
+}
+
+// Clone returns a new Map holding a copy of the contents of m at a single
+// instant, as returned by [Map.Snapshot].
+//
+// The new Map has the same promotion policy as m, and maintains its own
+// counters if m was created with [WithStats]. It does not share m's hooks or
+// watchers.
+func (m *Map[K, V]) Clone() *Map[K, V] {
+	ptrs := m.freeze()
+	c := &Map[K, V]{promote: m.promote}
+	if m.stats != nil {
+		c.stats = new(mapCounters)
+	}
+	read := make(map[K]*entry[V], len(ptrs))
+	for k, p := range ptrs {
+		// Values are never modified in place, so the clone can share them.
+		read[k] = &entry[V]{p: p}
+	}
+	c.read.Store(&readOnly[K, V]{m: read})
+	c.count.Store(int64(len(read)))
+	return c
+}
+
+// maxFreezePasses is the number of times freeze reads the entries of the map
+// before it locks them, so that it completes while they keep changing. It is
+// a variable so that tests can lower it.
+var maxFreezePasses = 4
+
+// freeze returns pointers to the values present in the map at a single
+// instant.
+//
+// Holding mu stops every operation that adds keys, but not the operations
+// that update existing entries, so freeze reads every entry repeatedly until
+// two passes agree. Every stored value has its own pointer (unless V has size
+// zero, when the values are indistinguishable anyway), so an entry whose
+// pointer is the same in both passes held that value throughout. Deleted
+// entries have no such identity, so freeze locks them, as a transaction does:
+// operations that find a locked entry wait for mu, so it stays deleted until
+// freeze returns.
+//
+// If the passes keep disagreeing, freeze locks the live entries too, which
+// stops every update.
+func (m *Map[K, V]) freeze() map[K]unsafe.Pointer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var held []heldEntry[V]
+	defer func() {
+		for _, h := range held {
+			atomic.StorePointer(&h.e.p, h.old)
+		}
+	}()
+
+	prev := m.collectLocked(&held, false)
+	for pass := 1; pass < maxFreezePasses; pass++ {
+		ptrs := m.collectLocked(&held, false)
+		if samePointers(prev, ptrs) {
+			return ptrs
+		}
+		prev = ptrs
+	}
+	// Each entry keeps its value from the moment it is locked, so when the
+	// last one is locked, they all hold the values returned.
+	return m.collectLocked(&held, true)
+}
+
+// A heldEntry is an entry locked by freeze, and the pointer it held before.
+type heldEntry[V any] struct {
+	e   *entry[V]
+	old unsafe.Pointer
+}
+
+// collectLocked returns pointers to the values of the entries of the map. It
+// locks deleted entries, or every entry if all is set, and appends them to
+// held.
+func (m *Map[K, V]) collectLocked(held *[]heldEntry[V], all bool) map[K]unsafe.Pointer {
+	read := m.loadReadOnly()
+	ptrs := make(map[K]unsafe.Pointer, len(read.m))
+	for k, e := range read.m {
+		if p := m.freezeEntryLocked(e, held, all); p != nil {
+			ptrs[k] = p
+		}
+	}
+	if read.amended {
+		for k, e := range m.dirty {
+			if _, ok := read.m[k]; ok {
+				continue
+			}
+			if p := m.freezeEntryLocked(e, held, all); p != nil {
+				ptrs[k] = p
+			}
+		}
+	}
+	return ptrs
+}
+
+// freezeEntryLocked returns the value pointer of e, or nil if e is deleted. It
+// locks e if e is deleted, or if all is set, and appends it to held.
+//
+// Transactions only lock entries while they hold mu, so an entry that is
+// already locked was locked by an earlier pass of freeze, while deleted.
+func (m *Map[K, V]) freezeEntryLocked(e *entry[V], held *[]heldEntry[V], all bool) unsafe.Pointer {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == expunged || p == locked {
+			return nil
+		}
+		if p != nil && !all {
+			return p
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, locked) {
+			*held = append(*held, heldEntry[V]{e, p})
+			return p
+		}
+	}
+}
+
+func samePointers[K comparable](a, b map[K]unsafe.Pointer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, p := range a {
+		if q, ok := b[k]; !ok || p != q {
+			return false
+		}
+	}
+	return true
+}
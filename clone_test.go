@@ -0,0 +1,127 @@
+package sync_map_test
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+func TestMapSnapshotAndClone(t *testing.T) {
+	m := sync_map.NewMap[string, int](sync_map.WithStats())
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Load("a")
+	m.Load("b") // Promote the dirty map.
+	m.Store("c", 3)
+	m.Delete("b")
+
+	want := map[string]int{"a": 1, "c": 3}
+	if got := m.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Snapshot() = %v; want %v", got, want)
+	}
+
+	c := m.Clone()
+	if got := mapContents(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("Clone() holds %v; want %v", got, want)
+	}
+	if c.Len() != len(want) {
+		t.Errorf("Clone().Len() = %v; want %v", c.Len(), len(want))
+	}
+
+	// The clone and the original are independent.
+	c.Store("a", 10)
+	c.Delete("c")
+	m.Store("d", 4)
+	if got := mapContents(m); !reflect.DeepEqual(got, map[string]int{"a": 1, "c": 3, "d": 4}) {
+		t.Errorf("after modifying the clone, original holds %v", got)
+	}
+	if got := mapContents(c); !reflect.DeepEqual(got, map[string]int{"a": 10}) {
+		t.Errorf("after modifying the original, clone holds %v", got)
+	}
+	if got := m.Snapshot(); !reflect.DeepEqual(got, map[string]int{"a": 1, "c": 3, "d": 4}) {
+		t.Errorf("second Snapshot() = %v", got)
+	}
+}
+
+func TestMapSnapshotConsistent(t *testing.T) {
+	testSnapshotConsistent(t)
+}
+
+// TestMapSnapshotConsistentLocked is like TestMapSnapshotConsistent, but makes
+// Snapshot lock every entry after its first pass.
+func TestMapSnapshotConsistentLocked(t *testing.T) {
+	defer sync_map.SetMaxFreezePasses(1)()
+	testSnapshotConsistent(t)
+}
+
+func testSnapshotConsistent(t *testing.T) {
+	const keys = 16
+	var m sync_map.Map[int, int]
+	for k := 0; k < keys; k++ {
+		m.Store(k, 0)
+	}
+	// Keys -1 and -2 take turns being present; at least one always is.
+	m.Store(-1, 0)
+	m.Range(func(int, int) bool { return true }) // Promote the dirty map.
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		// Store rounds of increasing values, one key at a time: at any instant,
+		// the keys before some index hold round i+1 and the rest round i.
+		for i := 1; !stop.Load(); i++ {
+			for k := 0; k < keys; k++ {
+				m.Swap(k, i)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; !stop.Load(); i++ {
+			on, off := -1-(i+1)%2, -1-i%2
+			m.Store(on, i)
+			m.LoadAndDelete(off)
+		}
+	}()
+
+	for n := 0; n < 1000; n++ {
+		snap := m.Snapshot()
+		for k := 1; k < keys; k++ {
+			if d := snap[k-1] - snap[k]; d != 0 && (d != 1 || snap[0] != snap[k-1]) {
+				t.Fatalf("inconsistent snapshot of rounds: %v", snap)
+			}
+		}
+		_, ok1 := snap[-1]
+		_, ok2 := snap[-2]
+		if !ok1 && !ok2 {
+			t.Fatalf("snapshot has neither -1 nor -2: %v", snap)
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+}
+
+// TestMapSnapshotCompact checks that Snapshot leaves the map in a state that
+// Compact and later stores handle, after deleting keys in the read map.
+func TestMapSnapshotCompact(t *testing.T) {
+	var m sync_map.Map[string, int]
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Promote()
+	m.Delete("a")
+	m.Snapshot()
+	m.Delete("b")
+	m.Compact()
+	m.Store("b", 3)
+	if v, ok := m.Load("b"); !ok || v != 3 {
+		t.Errorf("Load(b) = %v, %v; want 3, true", v, ok)
+	}
+	if n := m.Len(); n != 1 {
+		t.Errorf("Len() = %d; want 1", n)
+	}
+}
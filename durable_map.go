@@ -0,0 +1,627 @@
+package sync_map
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// A log written by a DurableMap starts with a header:
+//
+//	magic    "SWAL"
+//	version  1 byte, logVersion
+//
+// followed by one record per mutation:
+//
+//	sync     4 bytes, logSync
+//	op       1 byte, logStore or logDelete
+//	seq      uvarint sequence number: 1 for the first record, and one more
+//	         than the previous record for the others
+//	length   uvarint length of payload
+//	payload  the entry, encoded by the DurableMap's enc function
+//	checksum 4 bytes, big-endian CRC-32 (IEEE) of op, seq, length and payload
+//
+// A delete record holds the deleted key and the zero value of V.
+//
+// Only the last record can be torn by a crash. The sync marker and sequence
+// numbers let replay find out whether a bad record is followed by intact,
+// later records, and so is not the last one, without parsing the log at
+// every offset.
+const (
+	logMagic   = "SWAL"
+	logVersion = 1
+	logSync    = "\xa5REC"
+
+	logStore  = 1
+	logDelete = 2
+
+	logHeaderLen int64 = int64(len(logMagic)) + 1
+)
+
+// DurableMap is a [Map] whose mutations are recorded in an append-only log
+// file (a write-ahead log), so that its contents survive a restart or crash
+// of the process.
+//
+// Every mutation is appended to the log before it is applied to the map, and
+// the mutating methods return the error if it could not be appended; the map
+// is then left unchanged. Once an append fails, the log may end in a partial
+// record, so every later mutation fails with the same error.
+//
+// Loads and Range do not touch the log and are as fast as on a Map. Mutations
+// are serialized by a lock that is held while the record is written, and, by
+// default, while the log is synced to stable storage; see
+// [WithSyncInterval].
+//
+// The log grows with every mutation. [DurableMap.Checkpoint] writes the
+// contents of the map to a snapshot file next to the log and empties the log.
+//
+// A DurableMap must be created with [OpenDurableMap] and closed with
+// [DurableMap.Close].
+type DurableMap[K comparable, V any] struct {
+	m Map[K, V]
+
+	enc  func(K, V) ([]byte, error)
+	path string
+
+	mu       sync.Mutex // serializes mutations, and guards the fields below
+	f        *os.File
+	buf      []byte
+	seq      uint64 // the sequence number of the last record in the log
+	err      error  // sticky error from writing or syncing the log
+	unsynced bool   // records have been written since the last sync
+	interval time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// A DurableOption configures a DurableMap opened by [OpenDurableMap].
+type DurableOption func(*durableOptions)
+
+type durableOptions struct {
+	syncInterval time.Duration
+}
+
+// WithSyncInterval sets how often a DurableMap syncs its log to stable
+// storage.
+//
+// If d is zero, the default, each mutation syncs the log before it returns,
+// so a mutation that has returned survives a crash of the machine. If d is
+// positive, the log is synced in the background every d, so a crash of the
+// machine can lose the mutations of the last d; a crash of the process alone
+// loses nothing, because every record is written to the file before the
+// mutation returns. If d is negative, the log is only synced by
+// [DurableMap.Sync], [DurableMap.Checkpoint] and [DurableMap.Close].
+func WithSyncInterval(d time.Duration) DurableOption {
+	return func(o *durableOptions) {
+		o.syncInterval = d
+	}
+}
+
+// OpenDurableMap opens the DurableMap whose log is at path, creating an empty
+// log if none exists.
+//
+// The contents of the map are restored from the snapshot file written by the
+// last [DurableMap.Checkpoint], if there is one, and then by replaying the
+// log. enc encodes the entries written to the snapshot and the log, and dec
+// decodes them; see [Map.WriteSnapshot].
+//
+// If the log ends in an incomplete or corrupted record, as left by a crash
+// in the middle of an append, replay stops at that record and the log is
+// truncated to remove it and anything after it. A crash can only tear the
+// last record, so a corrupted record followed by an intact one is an error
+// wrapping [ErrCorruptLog], and the log is left unchanged. A corrupted
+// snapshot is an error wrapping [ErrCorruptSnapshot].
+func OpenDurableMap[K comparable, V any](path string, enc func(K, V) ([]byte, error), dec func([]byte) (K, V, error), opts ...DurableOption) (*DurableMap[K, V], error) {
+	var o durableOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	d := &DurableMap[K, V]{
+		enc:      enc,
+		path:     path,
+		interval: o.syncInterval,
+	}
+
+	if err := d.loadSnapshot(dec); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	end, err := d.replay(f, dec)
+	if err == nil {
+		err = d.trimLog(f, end)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	d.f = f
+
+	if d.interval > 0 {
+		d.stop = make(chan struct{})
+		d.done = make(chan struct{})
+		go d.syncLoop()
+	}
+	return d, nil
+}
+
+// ErrCorruptLog is returned by [OpenDurableMap] when the log holds a
+// corrupted record that is not at its end, so that it cannot have been left
+// by a crash.
+var ErrCorruptLog = errors.New("sync_map: corrupt log")
+
+// snapshotPath returns the path of the snapshot file for a log at path.
+func snapshotPath(path string) string {
+	return path + ".snapshot"
+}
+
+// loadSnapshot loads the snapshot file, if there is one, into the map.
+//
+// LoadSnapshot stores entries before it verifies the checksum, so a corrupted
+// snapshot may leave some of its entries in the map. This relies on the map
+// being new: OpenDurableMap discards it on error.
+func (d *DurableMap[K, V]) loadSnapshot(dec func([]byte) (K, V, error)) error {
+	f, err := os.Open(snapshotPath(d.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return d.m.LoadSnapshot(f, dec)
+}
+
+// replay applies the records in the log f to the map, and returns the offset
+// just past the last intact record, or 0 if the log has no intact header. It
+// sets d.seq to the sequence number of that record. It returns an error if an
+// intact record follows a bad one.
+func (d *DurableMap[K, V]) replay(f *os.File, dec func([]byte) (K, V, error)) (int64, error) {
+	r := bufio.NewReader(f)
+	var hdr [logHeaderLen]byte
+	if n, err := io.ReadFull(r, hdr[:]); err != nil {
+		// A header cut short by a crash while creating the log is rewritten;
+		// anything else is not a log.
+		if (err == io.EOF || err == io.ErrUnexpectedEOF) && bytes.HasPrefix([]byte(logMagic), hdr[:min(n, len(logMagic))]) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("sync_map: %s is not a DurableMap log", d.path)
+	}
+	if string(hdr[:len(logMagic)]) != logMagic {
+		return 0, fmt.Errorf("sync_map: %s is not a DurableMap log", d.path)
+	}
+	if v := hdr[len(logMagic)]; v != logVersion {
+		return 0, fmt.Errorf("sync_map: %s has unsupported log version %d", d.path, v)
+	}
+
+	end := int64(logHeaderLen)
+	var rec bytes.Buffer
+	for {
+		op, seq, payload, ok := readLogRecord(r, &rec)
+		if !ok || seq != d.seq+1 {
+			if intactRecordAfter(f, end, d.seq) {
+				return 0, fmt.Errorf("%w: %s: bad record at offset %d", ErrCorruptLog, d.path, end)
+			}
+			return end, nil
+		}
+		key, value, err := dec(payload)
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case logStore:
+			d.m.Store(key, value)
+		case logDelete:
+			d.m.Delete(key)
+		}
+		end += int64(rec.Len())
+		d.seq = seq
+	}
+}
+
+// intactRecordAfter reports whether f holds an intact record with a sequence
+// number after seq anywhere after the bad record at offset off. It looks for
+// records at each occurrence of logSync, so it reads the rest of the log
+// once, and only parses the records it finds there. A record copied into the
+// payload of a torn last record from earlier in the log has a lower sequence
+// number, so it does not make the log look corrupted.
+func intactRecordAfter(f *os.File, off int64, seq uint64) bool {
+	r := bufio.NewReader(io.NewSectionReader(f, off+1, math.MaxInt64-off-1))
+	var rec bytes.Buffer
+	pos, matched := off+1, 0
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return false
+		}
+		pos++
+		// logSync[0] appears only once in logSync, so a mismatch can only
+		// restart a match at c.
+		switch {
+		case c == logSync[matched]:
+			matched++
+		case c == logSync[0]:
+			matched = 1
+		default:
+			matched = 0
+		}
+		if matched < len(logSync) {
+			continue
+		}
+		matched = 0
+		start := pos - int64(len(logSync))
+		cr := bufio.NewReader(io.NewSectionReader(f, start, math.MaxInt64-start))
+		if _, s, _, ok := readLogRecord(cr, &rec); ok && s > seq {
+			return true
+		}
+	}
+}
+
+// A logReader is the reader that readLogRecord reads from.
+type logReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readLogRecord reads a record from r into rec, and returns its op, sequence
+// number and payload. It reports false if r does not hold a complete, intact
+// record.
+func readLogRecord(r logReader, rec *bytes.Buffer) (op byte, seq uint64, payload []byte, ok bool) {
+	rec.Reset()
+	if _, err := io.CopyN(rec, r, int64(len(logSync))); err != nil || rec.String() != logSync {
+		return 0, 0, nil, false
+	}
+	op, err := r.ReadByte()
+	if err != nil || (op != logStore && op != logDelete) {
+		return 0, 0, nil, false
+	}
+	seq, err = binary.ReadUvarint(r)
+	if err != nil {
+		return 0, 0, nil, false
+	}
+	l, err := binary.ReadUvarint(r)
+	if err != nil || l > uint64(1<<62) {
+		return 0, 0, nil, false
+	}
+	rec.WriteByte(op)
+	rec.Write(binary.AppendUvarint(nil, seq))
+	rec.Write(binary.AppendUvarint(nil, l))
+	hdrLen := rec.Len()
+	// Copy rather than allocating l bytes up front, so that a torn length
+	// fails at the end of the log instead of exhausting memory.
+	if _, err := io.CopyN(rec, r, int64(l)+4); err != nil {
+		return 0, 0, nil, false
+	}
+	b := rec.Bytes()
+	body, sum := b[len(logSync):len(b)-4], b[len(b)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return 0, 0, nil, false
+	}
+	return op, seq, b[hdrLen : len(b)-4], true
+}
+
+// trimLog truncates the log f to end, writing a new header if end is 0, and
+// positions f at its end for appending.
+func (d *DurableMap[K, V]) trimLog(f *os.File, end int64) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	changed := fi.Size() != end
+	if changed {
+		if err := f.Truncate(end); err != nil {
+			return err
+		}
+	}
+	if end == 0 {
+		changed = true
+		var hdr [logHeaderLen]byte
+		copy(hdr[:], logMagic)
+		hdr[len(logMagic)] = logVersion
+		if _, err := f.WriteAt(hdr[:], 0); err != nil {
+			return err
+		}
+		end = logHeaderLen
+	}
+	if changed {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		syncDir(filepath.Dir(d.path))
+	}
+	_, err = f.Seek(end, io.SeekStart)
+	return err
+}
+
+// syncDir syncs the directory dir, so that files created or renamed in it
+// survive a crash. Not every platform supports syncing a directory, so
+// errors are ignored.
+func syncDir(dir string) {
+	if f, err := os.Open(dir); err == nil {
+		f.Sync()
+		f.Close()
+	}
+}
+
+// appendLocked appends a record to the log. It must be called with d.mu
+// held, and the mutation must only be applied to the map if it succeeds.
+func (d *DurableMap[K, V]) appendLocked(op byte, key K, value V) error {
+	if d.err != nil {
+		return d.err
+	}
+	payload, err := d.enc(key, value)
+	if err != nil {
+		// Nothing has been written, so the log is still intact.
+		return err
+	}
+	b := append(d.buf[:0], logSync...)
+	b = append(b, op)
+	b = binary.AppendUvarint(b, d.seq+1)
+	b = binary.AppendUvarint(b, uint64(len(payload)))
+	b = append(b, payload...)
+	b = binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[len(logSync):]))
+	d.buf = b
+
+	if _, err := d.f.Write(b); err != nil {
+		d.err = err
+		return err
+	}
+	d.seq++
+	if d.interval != 0 {
+		d.unsynced = true
+		return nil
+	}
+	if err := d.f.Sync(); err != nil {
+		d.err = err
+		return err
+	}
+	return nil
+}
+
+func (d *DurableMap[K, V]) syncLoop() {
+	defer close(d.done)
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-t.C:
+			d.mu.Lock()
+			d.syncLocked()
+			d.mu.Unlock()
+		}
+	}
+}
+
+// syncLocked syncs any records written since the last sync.
+func (d *DurableMap[K, V]) syncLocked() error {
+	if d.err != nil || !d.unsynced {
+		return d.err
+	}
+	if err := d.f.Sync(); err != nil {
+		d.err = err
+		return err
+	}
+	d.unsynced = false
+	return nil
+}
+
+// Load returns the value stored in the map for a key, or the zero value if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (d *DurableMap[K, V]) Load(key K) (value V, ok bool) {
+	return d.m.Load(key)
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// Range has the same semantics as [Map.Range].
+func (d *DurableMap[K, V]) Range(f func(key K, value V) bool) {
+	d.m.Range(f)
+}
+
+// Len returns the number of entries in the map. See [Map.Len].
+func (d *DurableMap[K, V]) Len() int {
+	return d.m.Len()
+}
+
+// Store sets the value for a key.
+func (d *DurableMap[K, V]) Store(key K, value V) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.appendLocked(logStore, key, value); err != nil {
+		return err
+	}
+	d.m.Store(key, value)
+	return nil
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (d *DurableMap[K, V]) Swap(key K, value V) (previous V, loaded bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.appendLocked(logStore, key, value); err != nil {
+		return previous, false, err
+	}
+	previous, loaded = d.m.Swap(key, value)
+	return previous, loaded, nil
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+// Only a store is recorded in the log.
+func (d *DurableMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool, err error) {
+	// Loads do not take the lock, so try a plain load first.
+	if actual, loaded = d.m.Load(key); loaded {
+		return actual, true, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if actual, loaded = d.m.Load(key); loaded {
+		return actual, true, nil
+	}
+	if err := d.appendLocked(logStore, key, value); err != nil {
+		return actual, false, err
+	}
+	d.m.Store(key, value)
+	return value, false, nil
+}
+
+// Delete deletes the value for a key.
+func (d *DurableMap[K, V]) Delete(key K) error {
+	_, _, err := d.LoadAndDelete(key)
+	return err
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if
+// any. The loaded result reports whether the key was present. Deleting a key
+// that is not present is not recorded in the log.
+func (d *DurableMap[K, V]) LoadAndDelete(key K) (value V, loaded bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if value, loaded = d.m.Load(key); !loaded {
+		return value, false, d.err
+	}
+	var zero V
+	if err := d.appendLocked(logDelete, key, zero); err != nil {
+		return zero, false, err
+	}
+	d.m.Delete(key)
+	return value, true, nil
+}
+
+// DurableCompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+func DurableCompareAndSwap[K comparable, V comparable](d *DurableMap[K, V], key K, old, new V) (swapped bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Mutations hold d.mu, so the value cannot change between the comparison
+	// and the store.
+	if cur, ok := d.m.Load(key); !ok || cur != old {
+		return false, d.err
+	}
+	if err := d.appendLocked(logStore, key, new); err != nil {
+		return false, err
+	}
+	d.m.Store(key, new)
+	return true, nil
+}
+
+// DurableCompareAndDelete deletes the entry for key if its value is equal to
+// old.
+func DurableCompareAndDelete[K comparable, V comparable](d *DurableMap[K, V], key K, old V) (deleted bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cur, ok := d.m.Load(key); !ok || cur != old {
+		return false, d.err
+	}
+	var zero V
+	if err := d.appendLocked(logDelete, key, zero); err != nil {
+		return false, err
+	}
+	d.m.Delete(key)
+	return true, nil
+}
+
+// Sync syncs the log to stable storage, making every mutation that has
+// returned durable.
+func (d *DurableMap[K, V]) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.syncLocked()
+}
+
+// Checkpoint writes the contents of the map to the snapshot file and empties
+// the log, so that the next [OpenDurableMap] does not have to replay it.
+// Mutations block until Checkpoint returns.
+//
+// The snapshot is written to a temporary file that replaces the old snapshot
+// only once it is complete. If the process crashes after that but before the
+// log is emptied, the log is replayed over the new snapshot when the map is
+// next opened, which leaves the same contents.
+func (d *DurableMap[K, V]) Checkpoint() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.syncLocked(); err != nil {
+		return err
+	}
+
+	snap := snapshotPath(d.path)
+	tmp, err := os.CreateTemp(filepath.Dir(snap), filepath.Base(snap)+".tmp*")
+	if err != nil {
+		return err
+	}
+	err = d.m.WriteSnapshot(tmp, d.enc)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), snap)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	syncDir(filepath.Dir(snap))
+
+	// From here on, a failure leaves the log in an unknown state.
+	if err := d.f.Truncate(logHeaderLen); err != nil {
+		d.err = err
+		return err
+	}
+	d.seq = 0
+	if _, err := d.f.Seek(logHeaderLen, io.SeekStart); err != nil {
+		d.err = err
+		return err
+	}
+	if err := d.f.Sync(); err != nil {
+		d.err = err
+		return err
+	}
+	return nil
+}
+
+// Close syncs and closes the log. Mutations after Close fail with
+// [os.ErrClosed]; loads still see the contents of the map.
+func (d *DurableMap[K, V]) Close() error {
+	d.mu.Lock()
+	if d.f == nil {
+		d.mu.Unlock()
+		return os.ErrClosed
+	}
+	if d.stop != nil {
+		close(d.stop)
+	}
+	d.unsynced = true // Sync even with a negative interval.
+	err := d.syncLocked()
+	if cerr := d.f.Close(); err == nil {
+		err = cerr
+	}
+	d.f = nil
+	d.err = os.ErrClosed
+	d.mu.Unlock()
+
+	if d.done != nil {
+		<-d.done
+	}
+	return err
+}
@@ -0,0 +1,304 @@
+package sync_map_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+func openDurable(t *testing.T, path string, opts ...sync_map.DurableOption) *sync_map.DurableMap[string, string] {
+	t.Helper()
+	d, err := sync_map.OpenDurableMap(path, encodeStringPair, decodeStringPair, opts...)
+	if err != nil {
+		t.Fatalf("OpenDurableMap(%q) failed: %v", path, err)
+	}
+	return d
+}
+
+func durableContents(d *sync_map.DurableMap[string, string]) map[string]string {
+	contents := map[string]string{}
+	d.Range(func(k, v string) bool {
+		contents[k] = v
+		return true
+	})
+	return contents
+}
+
+// durableOps applies a fixed sequence of every kind of mutation to d, and
+// returns the contents of d after each mutation that changes it.
+func durableOps(t *testing.T, d *sync_map.DurableMap[string, string]) []map[string]string {
+	t.Helper()
+	var states []map[string]string
+	check := func(changed bool, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed {
+			states = append(states, durableContents(d))
+		}
+	}
+
+	check(true, d.Store("a", "1"))
+	check(true, d.Store("b", "2"))
+	_, loaded, err := d.Swap("a", "3")
+	check(true, err)
+	if !loaded {
+		t.Errorf("Swap of present key reported loaded = false")
+	}
+	_, loaded, err = d.LoadOrStore("c", "4")
+	check(!loaded, err)
+	_, loaded, err = d.LoadOrStore("c", "5")
+	check(!loaded, err)
+	swapped, err := sync_map.DurableCompareAndSwap(d, "b", "2", "6")
+	check(swapped, err)
+	swapped, err = sync_map.DurableCompareAndSwap(d, "b", "2", "7")
+	check(swapped, err)
+	deleted, err := sync_map.DurableCompareAndDelete(d, "a", "1")
+	check(deleted, err)
+	deleted, err = sync_map.DurableCompareAndDelete(d, "a", "3")
+	check(deleted, err)
+	_, loaded, err = d.LoadAndDelete("c")
+	check(loaded, err)
+	check(true, d.Store("d", ""))
+	check(true, d.Delete("b"))
+	check(false, d.Delete("b"))
+
+	if want := 9; len(states) != want {
+		t.Fatalf("durableOps changed the map %v times; want %v", len(states), want)
+	}
+	return states
+}
+
+func TestDurableMapReplay(t *testing.T) {
+	for _, interval := range []time.Duration{0, time.Millisecond, -1} {
+		path := filepath.Join(t.TempDir(), "log")
+		d := openDurable(t, path, sync_map.WithSyncInterval(interval))
+		states := durableOps(t, d)
+		want := states[len(states)-1]
+		if err := d.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		d = openDurable(t, path)
+		if got := durableContents(d); !reflect.DeepEqual(got, want) {
+			t.Errorf("with sync interval %v, reopened map holds %v; want %v", interval, got, want)
+		}
+		d.Close()
+	}
+}
+
+func TestDurableMapTornWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+	d := openDurable(t, path)
+	states := durableOps(t, d)
+	d.Close()
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n <= len(log); n++ {
+		torn := filepath.Join(dir, "torn")
+		if err := os.WriteFile(torn, log[:n], 0o666); err != nil {
+			t.Fatal(err)
+		}
+		d := openDurable(t, torn)
+		got := durableContents(d)
+		// The torn log must replay to the state after some prefix of the
+		// mutations.
+		ok := len(got) == 0
+		for _, s := range states {
+			ok = ok || reflect.DeepEqual(got, s)
+		}
+		if !ok {
+			t.Fatalf("log truncated to %v bytes replays to %v, which is not a state the map was in", n, got)
+		}
+
+		// Mutations after recovery must not be lost behind the torn record.
+		if err := d.Store("after", "tear"); err != nil {
+			t.Fatal(err)
+		}
+		d.Close()
+		d = openDurable(t, torn)
+		if v, ok := d.Load("after"); !ok || v != "tear" {
+			t.Fatalf("log truncated to %v bytes lost a later store: Load(%q) = %q, %v", n, "after", v, ok)
+		}
+		d.Close()
+	}
+}
+
+func TestDurableMapCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	d := openDurable(t, path)
+	d.Store("a", "1")
+	d.Store("b", "2")
+	d.Close()
+
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log[len(log)-5] ^= 0xff
+	if err := os.WriteFile(path, log, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	d = openDurable(t, path)
+	defer d.Close()
+	if got, want := durableContents(d), map[string]string{"a": "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("log with corrupted last record replays to %v; want %v", got, want)
+	}
+}
+
+// TestDurableMapCorruptMiddleRecord checks that a corrupted record followed by
+// intact ones, which cannot be left by a crash, is reported rather than
+// truncated along with them.
+func TestDurableMapCorruptMiddleRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	d := openDurable(t, path)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		d.Store(k, k)
+	}
+	d.Close()
+
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip a byte in the payload of the first record, after the header, the
+	// record's sync marker, op, sequence number, length and key length.
+	log[13] ^= 0xff
+	if err := os.WriteFile(path, log, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sync_map.OpenDurableMap(path, encodeStringPair, decodeStringPair); !errors.Is(err, sync_map.ErrCorruptLog) {
+		t.Errorf("OpenDurableMap with corrupted first record: err = %v; want ErrCorruptLog", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, log) {
+		t.Errorf("OpenDurableMap changed a log with a corrupted first record from %v to %v bytes", len(log), len(got))
+	}
+}
+
+func TestDurableMapTornRecordHoldingRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	d := openDurable(t, path)
+	d.Store("a", "a")
+	d.Close()
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Store a value that holds an intact copy of the first record, then tear
+	// off the checksum of the record storing it.
+	d = openDurable(t, path)
+	d.Store("b", string(log[5:]))
+	d.Close()
+	if log, err = os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, log[:len(log)-4], 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = sync_map.OpenDurableMap(path, encodeStringPair, decodeStringPair)
+	if err != nil {
+		t.Fatalf("OpenDurableMap with a torn record holding an earlier record failed: %v", err)
+	}
+	defer d.Close()
+	if got, want := durableContents(d), map[string]string{"a": "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("log with a torn record holding an earlier record replays to %v; want %v", got, want)
+	}
+}
+
+func TestDurableMapCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	d := openDurable(t, path)
+	states := durableOps(t, d)
+	if err := d.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 5 {
+		t.Errorf("log holds %v bytes after Checkpoint; want only the 5-byte header", fi.Size())
+	}
+	d.Store("e", "8")
+	d.Close()
+
+	want := states[len(states)-1]
+	want["e"] = "8"
+	d = openDurable(t, path)
+	if got := durableContents(d); !reflect.DeepEqual(got, want) {
+		t.Errorf("map reopened after Checkpoint holds %v; want %v", got, want)
+	}
+	d.Close()
+
+	snap, err := os.ReadFile(path + ".snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap[len(snap)-1] ^= 0xff
+	if err := os.WriteFile(path+".snapshot", snap, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sync_map.OpenDurableMap(path, encodeStringPair, decodeStringPair); !errors.Is(err, sync_map.ErrCorruptSnapshot) {
+		t.Errorf("OpenDurableMap with corrupted snapshot: err = %v; want ErrCorruptSnapshot", err)
+	}
+}
+
+func TestDurableMapErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+
+	encErr := errors.New("enc failed")
+	d, err := sync_map.OpenDurableMap(path, func(k, v string) ([]byte, error) {
+		if v == "bad" {
+			return nil, encErr
+		}
+		return encodeStringPair(k, v)
+	}, decodeStringPair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Store("a", "bad"); err != encErr {
+		t.Errorf("Store with failing enc: err = %v; want %v", err, encErr)
+	}
+	if _, ok := d.Load("a"); ok {
+		t.Errorf("Store with failing enc changed the map")
+	}
+	if err := d.Store("a", "good"); err != nil {
+		t.Errorf("Store after enc failure: err = %v; want nil", err)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := d.Store("b", "2"); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Store after Close: err = %v; want os.ErrClosed", err)
+	}
+	if v, ok := d.Load("a"); !ok || v != "good" {
+		t.Errorf("Load after Close = %q, %v; want %q, true", v, ok, "good")
+	}
+
+	notLog := filepath.Join(dir, "notlog")
+	if err := os.WriteFile(notLog, []byte("not a log"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sync_map.OpenDurableMap(notLog, encodeStringPair, decodeStringPair); err == nil {
+		t.Errorf("OpenDurableMap of a file that is not a log succeeded")
+	}
+}
@@ -0,0 +1,236 @@
+package sync_map
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock tells an [ExpiringMap] the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// ExpiringMap is like a [Map], but its entries expire after a time to live
+// (TTL). An expired entry is invisible to every method, as if it had been
+// deleted.
+//
+// Expired entries are removed lazily, when a method finds them, and, if the
+// map was created with [WithJanitor], by a background goroutine. An entry is
+// only removed if it has not been stored again since it was found to be
+// expired, so removal never loses a value stored concurrently.
+//
+// The zero ExpiringMap is not usable; create one with [NewExpiringMap].
+// An ExpiringMap must not be copied after first use.
+type ExpiringMap[K comparable, V any] struct {
+	// Each store allocates a new entry, so entries are compared by pointer
+	// identity, and removing an expired entry with CompareAndDelete cannot
+	// remove a value stored after it.
+	m     Map[K, *expiringEntry[V]]
+	ttl   time.Duration
+	clock Clock
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type expiringEntry[V any] struct {
+	value   V
+	expires time.Time // zero if the entry never expires
+}
+
+func (e *expiringEntry[V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// An ExpiringOption configures an ExpiringMap created by [NewExpiringMap].
+type ExpiringOption func(*expiringOptions)
+
+type expiringOptions struct {
+	clock   Clock
+	janitor time.Duration
+}
+
+// WithClock sets the clock used to decide when entries expire. The default
+// is the system clock.
+func WithClock(c Clock) ExpiringOption {
+	return func(o *expiringOptions) {
+		o.clock = c
+	}
+}
+
+// WithJanitor starts a goroutine that calls [ExpiringMap.DeleteExpired] every
+// interval, so that expired entries that are never looked up again are still
+// removed. The goroutine runs until [ExpiringMap.Close] is called.
+//
+// The interval is measured in real time, even if the map uses a different
+// [Clock].
+func WithJanitor(interval time.Duration) ExpiringOption {
+	return func(o *expiringOptions) {
+		o.janitor = interval
+	}
+}
+
+// NewExpiringMap returns an empty ExpiringMap whose entries stored with
+// [ExpiringMap.Store] expire after ttl. If ttl <= 0, they never expire.
+func NewExpiringMap[K comparable, V any](ttl time.Duration, opts ...ExpiringOption) *ExpiringMap[K, V] {
+	o := expiringOptions{clock: systemClock{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	m := &ExpiringMap[K, V]{
+		ttl:   ttl,
+		clock: o.clock,
+	}
+	if o.janitor > 0 {
+		m.stop = make(chan struct{})
+		m.done = make(chan struct{})
+		go m.janitor(o.janitor)
+	}
+	return m
+}
+
+func (m *ExpiringMap[K, V]) janitor(interval time.Duration) {
+	defer close(m.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-t.C:
+			m.DeleteExpired()
+		}
+	}
+}
+
+// Close stops the janitor goroutine, if the map has one. The map remains
+// usable, but expired entries are then only removed lazily.
+func (m *ExpiringMap[K, V]) Close() {
+	if m.stop == nil {
+		return
+	}
+	m.closeOnce.Do(func() {
+		close(m.stop)
+		<-m.done
+	})
+}
+
+func (m *ExpiringMap[K, V]) newEntry(value V, ttl time.Duration) *expiringEntry[V] {
+	e := &expiringEntry[V]{value: value}
+	if ttl > 0 {
+		e.expires = m.clock.Now().Add(ttl)
+	}
+	return e
+}
+
+// live returns e if it is present and has not expired. An expired entry is
+// removed from the map, unless it has already been replaced.
+func (m *ExpiringMap[K, V]) live(key K, e *expiringEntry[V], ok bool) (*expiringEntry[V], bool) {
+	if !ok {
+		return nil, false
+	}
+	if e.expired(m.clock.Now()) {
+		CompareAndDelete(&m.m, key, e)
+		return nil, false
+	}
+	return e, true
+}
+
+// Load returns the value stored in the map for a key, or the zero value if no
+// value is present or it has expired.
+// The ok result indicates whether value was found in the map.
+func (m *ExpiringMap[K, V]) Load(key K) (value V, ok bool) {
+	e, ok := m.m.Load(key)
+	if e, ok = m.live(key, e, ok); !ok {
+		return value, false
+	}
+	return e.value, true
+}
+
+// Store sets the value for a key, expiring after the map's default TTL.
+func (m *ExpiringMap[K, V]) Store(key K, value V) {
+	m.StoreWithTTL(key, value, m.ttl)
+}
+
+// StoreWithTTL sets the value for a key, expiring after ttl. If ttl <= 0, the
+// entry never expires.
+func (m *ExpiringMap[K, V]) StoreWithTTL(key K, value V, ttl time.Duration) {
+	m.m.Store(key, m.newEntry(value, ttl))
+}
+
+// LoadOrStore returns the existing value for the key if present and not
+// expired. Otherwise, it stores and returns the given value, expiring after
+// the map's default TTL.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *ExpiringMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	e := m.newEntry(value, m.ttl)
+	for {
+		old, loaded := m.m.LoadOrStore(key, e)
+		if !loaded {
+			return value, false
+		}
+		if !old.expired(m.clock.Now()) {
+			return old.value, true
+		}
+		// Replace the expired entry, unless another store has already.
+		if CompareAndSwap(&m.m, key, old, e) {
+			return value, false
+		}
+	}
+}
+
+// Delete deletes the value for a key.
+func (m *ExpiringMap[K, V]) Delete(key K) {
+	m.m.Delete(key)
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if
+// any. The loaded result reports whether the key was present and had not
+// expired.
+func (m *ExpiringMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	e, loaded := m.m.LoadAndDelete(key)
+	if !loaded || e.expired(m.clock.Now()) {
+		return value, false
+	}
+	return e.value, true
+}
+
+// Range calls f sequentially for each key and value present in the map that
+// has not expired. If f returns false, range stops the iteration.
+//
+// Range has the same semantics as [Map.Range]. Expired entries that Range
+// visits are removed.
+func (m *ExpiringMap[K, V]) Range(f func(key K, value V) bool) {
+	m.m.Range(func(key K, e *expiringEntry[V]) bool {
+		if e, ok := m.live(key, e, true); ok {
+			return f(key, e.value)
+		}
+		return true
+	})
+}
+
+// Len returns the number of entries in the map, including expired entries
+// that have not been removed yet. See [Map.Len].
+func (m *ExpiringMap[K, V]) Len() int {
+	return m.m.Len()
+}
+
+// DeleteExpired removes every expired entry from the map, and returns the
+// number removed. Entries stored again after they were found to be expired
+// are not removed.
+func (m *ExpiringMap[K, V]) DeleteExpired() int {
+	now := m.clock.Now()
+	n := 0
+	m.m.Range(func(key K, e *expiringEntry[V]) bool {
+		if e.expired(now) && CompareAndDelete(&m.m, key, e) {
+			n++
+		}
+		return true
+	})
+	return n
+}
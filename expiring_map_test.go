@@ -0,0 +1,161 @@
+package sync_map_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func expiringContents[K comparable, V any](m *sync_map.ExpiringMap[K, V]) map[K]V {
+	contents := map[K]V{}
+	m.Range(func(k K, v V) bool {
+		contents[k] = v
+		return true
+	})
+	return contents
+}
+
+func TestExpiringMapExpiry(t *testing.T) {
+	clock := newFakeClock()
+	m := sync_map.NewExpiringMap[string, int](time.Minute, sync_map.WithClock(clock))
+	m.Store("default", 1)
+	m.StoreWithTTL("short", 2, time.Second)
+	m.StoreWithTTL("forever", 3, 0)
+
+	if got, want := expiringContents(m), map[string]int{"default": 1, "short": 2, "forever": 3}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("before expiry, map holds %v; want %v", got, want)
+	}
+
+	clock.Advance(time.Second)
+	if v, ok := m.Load("short"); ok {
+		t.Errorf("Load of expired key = %v, true; want _, false", v)
+	}
+	if got, want := expiringContents(m), map[string]int{"default": 1, "forever": 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after 1s, map holds %v; want %v", got, want)
+	}
+
+	clock.Advance(time.Hour)
+	if _, loaded := m.LoadAndDelete("default"); loaded {
+		t.Errorf("LoadAndDelete of expired key reported loaded = true")
+	}
+	if got, want := expiringContents(m), map[string]int{"forever": 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after 1h, map holds %v; want %v", got, want)
+	}
+}
+
+func TestExpiringMapLoadOrStore(t *testing.T) {
+	clock := newFakeClock()
+	m := sync_map.NewExpiringMap[string, int](time.Minute, sync_map.WithClock(clock))
+
+	if actual, loaded := m.LoadOrStore("k", 1); loaded || actual != 1 {
+		t.Errorf("LoadOrStore of new key = %v, %v; want 1, false", actual, loaded)
+	}
+	if actual, loaded := m.LoadOrStore("k", 2); !loaded || actual != 1 {
+		t.Errorf("LoadOrStore of present key = %v, %v; want 1, true", actual, loaded)
+	}
+	clock.Advance(time.Minute)
+	if actual, loaded := m.LoadOrStore("k", 3); loaded || actual != 3 {
+		t.Errorf("LoadOrStore of expired key = %v, %v; want 3, false", actual, loaded)
+	}
+	if v, ok := m.Load("k"); !ok || v != 3 {
+		t.Errorf("Load after replacing expired key = %v, %v; want 3, true", v, ok)
+	}
+}
+
+func TestExpiringMapDeleteExpired(t *testing.T) {
+	clock := newFakeClock()
+	m := sync_map.NewExpiringMap[int, int](time.Minute, sync_map.WithClock(clock))
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+	clock.Advance(30 * time.Second)
+	m.Store(0, 100)
+	clock.Advance(30 * time.Second)
+
+	if n := m.DeleteExpired(); n != 9 {
+		t.Errorf("DeleteExpired removed %v entries; want 9", n)
+	}
+	if got, want := expiringContents(m), map[int]int{0: 100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after DeleteExpired, map holds %v; want %v", got, want)
+	}
+}
+
+func TestExpiringMapConcurrentRefresh(t *testing.T) {
+	clock := newFakeClock()
+	m := sync_map.NewExpiringMap[int, int](time.Second, sync_map.WithClock(clock))
+
+	const keys = 64
+	for i := 0; i < keys; i++ {
+		m.Store(i, 0)
+	}
+	clock.Advance(time.Second)
+
+	// Refresh every key while removing expired entries concurrently: no
+	// refreshed value may be removed.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < keys; i++ {
+			m.Store(i, 1)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			m.DeleteExpired()
+		}
+	}()
+	wg.Wait()
+
+	for i := 0; i < keys; i++ {
+		if v, ok := m.Load(i); !ok || v != 1 {
+			t.Errorf("Load(%v) after refresh = %v, %v; want 1, true", i, v, ok)
+		}
+	}
+}
+
+func TestExpiringMapJanitor(t *testing.T) {
+	clock := newFakeClock()
+	m := sync_map.NewExpiringMap[string, int](time.Second, sync_map.WithClock(clock), sync_map.WithJanitor(time.Millisecond))
+	defer m.Close()
+
+	m.Store("k", 1)
+	clock.Advance(time.Second)
+	// Len counts expired entries until they are removed, and does not remove
+	// them itself, so it only drops to 0 once the janitor has run.
+	deadline := time.Now().Add(10 * time.Second)
+	for m.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("janitor did not remove expired entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	m.Close()
+	m.Close()
+}
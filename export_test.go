@@ -0,0 +1,27 @@
+package sync_map
+
+// Watchers returns the number of watchers registered on m.
+func Watchers[K comparable, V any](m *Map[K, V]) int {
+	if r := m.watch.Load(); r != nil {
+		return int(r.n.Load())
+	}
+	return 0
+}
+
+// WaitingKeys returns the number of keys that goroutines are waiting for in
+// LoadWait.
+func WaitingKeys[K comparable, V any](m *Map[K, V]) int {
+	if w := m.wait.Load(); w != nil {
+		return w.keys.Len()
+	}
+	return 0
+}
+
+// SetMaxFreezePasses sets the number of times Snapshot and Clone read the
+// entries of a map before they lock them, and returns a function that
+// restores it.
+func SetMaxFreezePasses(n int) (restore func()) {
+	old := maxFreezePasses
+	maxFreezePasses = n
+	return func() { maxFreezePasses = old }
+}
@@ -0,0 +1,72 @@
+package sync_map
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+)
+
+// gobEntry is the gob message for one entry of a Map.
+type gobEntry[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// GobEncode implements [encoding/gob.GobEncoder].
+//
+// The result is a gob stream holding one message for each entry in the map.
+// Keys and values are encoded with encoding/gob, so they are subject to its
+// rules: for example, unexported struct fields are not encoded, and the
+// concrete types of interface keys and values must be registered with
+// [encoding/gob.Register].
+//
+// The entries are visited with [Map.Range], so the result does not
+// necessarily correspond to any consistent snapshot of the Map's contents if
+// it is modified concurrently.
+func (m *Map[K, V]) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	var err error
+	m.Range(func(key K, value V) bool {
+		err = enc.Encode(gobEntry[K, V]{Key: key, Value: value})
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements [encoding/gob.GobDecoder].
+//
+// Each entry is decoded and stored in the map as it is read; entries already
+// in the map are kept unless the data replaces them. If an error is returned,
+// the entries decoded before the error have already been stored.
+func (m *Map[K, V]) GobDecode(data []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	for {
+		// Decode into a fresh entry each time: gob leaves fields that were
+		// not transmitted (because they were zero) unchanged.
+		var e gobEntry[K, V]
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		m.Store(e.Key, e.Value)
+	}
+}
+
+// MarshalBinary implements [encoding.BinaryMarshaler].
+// It produces the same encoding as [Map.GobEncode].
+func (m *Map[K, V]) MarshalBinary() ([]byte, error) {
+	return m.GobEncode()
+}
+
+// UnmarshalBinary implements [encoding.BinaryUnmarshaler].
+// It decodes the encoding produced by [Map.MarshalBinary], as
+// [Map.GobDecode] does.
+func (m *Map[K, V]) UnmarshalBinary(data []byte) error {
+	return m.GobDecode(data)
+}
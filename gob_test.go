@@ -0,0 +1,123 @@
+package sync_map_test
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"reflect"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+var (
+	_ gob.GobEncoder             = &sync_map.Map[string, int]{}
+	_ gob.GobDecoder             = &sync_map.Map[string, int]{}
+	_ encoding.BinaryMarshaler   = &sync_map.Map[string, int]{}
+	_ encoding.BinaryUnmarshaler = &sync_map.Map[string, int]{}
+)
+
+type gobPoint struct {
+	X, Y int
+}
+
+type gobRecord struct {
+	Name   string
+	Scores []float64
+	Attrs  map[string]string
+	Next   *gobPoint
+}
+
+func mapContents[K comparable, V any](m *sync_map.Map[K, V]) map[K]V {
+	contents := map[K]V{}
+	m.Range(func(k K, v V) bool {
+		contents[k] = v
+		return true
+	})
+	return contents
+}
+
+// checkGobRoundTrip checks that a Map holding entries survives both encoding
+// paths unchanged.
+func checkGobRoundTrip[K comparable, V any](t *testing.T, entries map[K]V) {
+	t.Helper()
+
+	m := new(sync_map.Map[K, V])
+	for k, v := range entries {
+		m.Store(k, v)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		t.Fatalf("gob encoding %T failed: %v", m, err)
+	}
+	decoded := new(sync_map.Map[K, V])
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatalf("gob decoding %T failed: %v", m, err)
+	}
+	if got := mapContents(decoded); !reflect.DeepEqual(got, entries) {
+		t.Errorf("gob round trip of %v produced %v", entries, got)
+	}
+
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary of %T failed: %v", m, err)
+	}
+	decoded = new(sync_map.Map[K, V])
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary of %T failed: %v", m, err)
+	}
+	if got := mapContents(decoded); !reflect.DeepEqual(got, entries) {
+		t.Errorf("binary round trip of %v produced %v", entries, got)
+	}
+}
+
+func TestMapGobRoundTrip(t *testing.T) {
+	checkGobRoundTrip(t, map[string]int{})
+	checkGobRoundTrip(t, map[string]int{"a": 1, "b": 0, "": -1})
+	checkGobRoundTrip(t, map[int]gobPoint{0: {}, 1: {1, 2}, -5: {X: -5}})
+	checkGobRoundTrip(t, map[gobPoint]gobRecord{
+		{1, 2}: {Name: "a", Scores: []float64{1.5, 2.5}, Attrs: map[string]string{"k": "v"}, Next: &gobPoint{3, 4}},
+		{0, 0}: {Name: "zero"},
+	})
+	checkGobRoundTrip(t, map[any]any{"a": 1, 2: "b", "c": []string{"d"}, 3.5: true})
+}
+
+func TestCasMapGobRoundTrip(t *testing.T) {
+	var m CasMap[any, any]
+	m.Store("a", 1)
+	m.Store(2, "b")
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&m); err != nil {
+		t.Fatalf("gob encoding CasMap[any, any] failed: %v", err)
+	}
+	var decoded CasMap[any, any]
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatalf("gob decoding CasMap[any, any] failed: %v", err)
+	}
+	if got, want := mapContents(&decoded.Map), mapContents(&m.Map); !reflect.DeepEqual(got, want) {
+		t.Errorf("gob round trip of %v produced %v", want, got)
+	}
+	if !decoded.CompareAndSwap("a", 1, 10) {
+		t.Errorf("CompareAndSwap on decoded CasMap failed")
+	}
+}
+
+func TestMapGobDecodeErrors(t *testing.T) {
+	var m sync_map.Map[string, int]
+	m.Store("a", 1)
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wrongType sync_map.Map[string, string]
+	if err := wrongType.UnmarshalBinary(data); err == nil {
+		t.Errorf("decoding Map[string, int] into Map[string, string] succeeded")
+	}
+	var truncated sync_map.Map[string, int]
+	if err := truncated.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Errorf("decoding truncated data succeeded")
+	}
+}
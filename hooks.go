@@ -0,0 +1,93 @@
+package sync_map
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Hooks are functions that a [Map] calls after its contents change, for
+// keeping secondary indexes or metrics in sync with the map. Either function
+// may be nil.
+//
+// The hooks are called after the change has been made, by the goroutine that
+// made it, and without holding the Map's internal lock, so they may call any
+// method on the Map. Because they are not called under a lock, the hooks for
+// concurrent changes to the same key may run concurrently, or in a different
+// order from the changes themselves.
+//
+// A Map only has hooks if it was created with [WithHooks]; the zero Map has
+// none, and pays only a check of a flag for them, shared with watchers and
+// waiters.
+type Hooks[K comparable, V any] struct {
+	// OnStore is called after value new is stored for key, whether by Store,
+	// Swap, LoadOrStore, CompareAndSwap or Compute. If the key already held
+	// a value, replaced is true and old is that value; otherwise old is the
+	// zero value.
+	OnStore func(key K, old V, replaced bool, new V)
+	// OnDelete is called after the value old is removed for key, whether by
+	// Delete, LoadAndDelete, CompareAndDelete, Compute or Clear. It is not
+	// called for deletes of keys that are not present.
+	OnDelete func(key K, old V)
+}
+
+// WithHooks sets the hooks that the Map calls after its contents change.
+//
+// The type parameters of h must match those of the Map being created;
+// otherwise, creating the Map panics.
+func WithHooks[K comparable, V any](h Hooks[K, V]) Option {
+	return func(o *options) {
+		o.hooks = &h
+	}
+}
+
+// configureHooks sets the hooks of m from the value set by WithHooks.
+func (m *Map[K, V]) configureHooks(hooks any) {
+	if hooks == nil {
+		return
+	}
+	h, ok := hooks.(*Hooks[K, V])
+	if !ok {
+		// Format the types rather than zero values, which are nil for
+		// interface types. (reflect.TypeFor needs Go 1.22.)
+		k, v := reflect.TypeOf((*K)(nil)).Elem(), reflect.TypeOf((*V)(nil)).Elem()
+		panic(fmt.Sprintf("sync_map: WithHooks called with %T for a Map[%v, %v]", hooks, k, v))
+	}
+	if h.OnStore != nil || h.OnDelete != nil {
+		m.observed.Store(true)
+		m.hooks = h
+	}
+}
+
+// afterStore and afterDelete report a change to the Map's hooks, watchers
+// and waiters, if it has any. They must be called without holding mu. They
+// are small enough to be inlined, so that the fast paths of a Map without
+// any only check observed.
+func (m *Map[K, V]) afterStore(key K, old V, replaced bool, new V) {
+	if m.observed.Load() {
+		m.notifyStore(key, old, replaced, new)
+	}
+}
+
+func (m *Map[K, V]) afterDelete(key K, old V) {
+	if m.observed.Load() {
+		m.notifyDelete(key, old)
+	}
+}
+
+func (m *Map[K, V]) notifyStore(key K, old V, replaced bool, new V) {
+	if h := m.hooks; h != nil && h.OnStore != nil {
+		h.OnStore(key, old, replaced, new)
+	}
+	m.watchStored(key, old, replaced, new)
+	if !replaced {
+		// Goroutines only wait for keys that are not present.
+		m.wakeWaiters(key)
+	}
+}
+
+func (m *Map[K, V]) notifyDelete(key K, old V) {
+	if h := m.hooks; h != nil && h.OnDelete != nil {
+		h.OnDelete(key, old)
+	}
+	m.watchDeleted(key, old)
+}
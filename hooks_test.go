@@ -0,0 +1,188 @@
+package sync_map_test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+// hookRecorder records the calls to a Map's hooks as strings.
+type hookRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *hookRecorder) hooks() sync_map.Hooks[string, int] {
+	return sync_map.Hooks[string, int]{
+		OnStore: func(key string, old int, replaced bool, new int) {
+			r.record(fmt.Sprintf("store %s %d %v %d", key, old, replaced, new))
+		},
+		OnDelete: func(key string, old int) {
+			r.record(fmt.Sprintf("delete %s %d", key, old))
+		},
+	}
+}
+
+func (r *hookRecorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// take returns the events recorded since the last call.
+func (r *hookRecorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func TestMapHooks(t *testing.T) {
+	var r hookRecorder
+	m := sync_map.NewMap[string, int](sync_map.WithHooks(r.hooks()))
+
+	steps := []struct {
+		op   func()
+		want []string
+	}{
+		{func() { m.Store("a", 1) }, []string{"store a 0 false 1"}},
+		{func() { m.Store("a", 2) }, []string{"store a 1 true 2"}},
+		{func() { m.Swap("b", 3) }, []string{"store b 0 false 3"}},
+		{func() { m.LoadOrStore("b", 4) }, nil},
+		{func() { m.LoadOrStore("c", 5) }, []string{"store c 0 false 5"}},
+		{func() { m.Load("c") }, nil},
+		{func() { sync_map.CompareAndSwap(m, "c", 0, 6) }, nil},
+		{func() { sync_map.CompareAndSwap(m, "c", 5, 6) }, []string{"store c 5 true 6"}},
+		{func() { sync_map.CompareAndDelete(m, "c", 5) }, nil},
+		{func() { sync_map.CompareAndDelete(m, "c", 6) }, []string{"delete c 6"}},
+		{func() { m.LoadAndDelete("b") }, []string{"delete b 3"}},
+		{func() { m.Delete("b") }, nil},
+		{func() {
+			m.Compute("a", func(old int, _ bool) (int, sync_map.ComputeOp) { return old + 1, sync_map.UpdateOp })
+		}, []string{"store a 2 true 3"}},
+		{func() {
+			m.Compute("d", func(int, bool) (int, sync_map.ComputeOp) { return 7, sync_map.CancelOp })
+		}, nil},
+		{func() {
+			m.Compute("d", func(int, bool) (int, sync_map.ComputeOp) { return 0, sync_map.DeleteOp })
+		}, nil},
+		{func() {
+			m.Compute("a", func(int, bool) (int, sync_map.ComputeOp) { return 0, sync_map.DeleteOp })
+		}, []string{"delete a 3"}},
+		{func() { m.LoadOrCompute("e", func() int { return 8 }) }, []string{"store e 0 false 8"}},
+		{func() { m.LoadOrCompute("e", func() int { return 9 }) }, nil},
+	}
+	for i, step := range steps {
+		step.op()
+		if got := r.take(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: hooks recorded %q; want %q", i, got, step.want)
+		}
+	}
+}
+
+// TestMapHooksMirror checks that a plain map maintained by the hooks always
+// matches the Map, whichever paths the operations take.
+func TestMapHooksMirror(t *testing.T) {
+	mirror := map[int]int{}
+	var hookErr error
+	m := sync_map.NewMap[int, int](sync_map.WithHooks(sync_map.Hooks[int, int]{
+		OnStore: func(key, old int, replaced bool, new int) {
+			if prev, ok := mirror[key]; ok != replaced || prev != old {
+				hookErr = fmt.Errorf("OnStore(%v, %v, %v, %v) but mirror held %v, %v", key, old, replaced, new, prev, ok)
+			}
+			mirror[key] = new
+		},
+		OnDelete: func(key, old int) {
+			if prev, ok := mirror[key]; !ok || prev != old {
+				hookErr = fmt.Errorf("OnDelete(%v, %v) but mirror held %v, %v", key, old, prev, ok)
+			}
+			delete(mirror, key)
+		},
+	}))
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		k, v := r.Intn(32), r.Intn(4)
+		switch r.Intn(7) {
+		case 0:
+			m.Store(k, v)
+		case 1:
+			m.LoadOrStore(k, v)
+		case 2:
+			m.LoadAndDelete(k)
+		case 3:
+			m.Swap(k, v)
+		case 4:
+			sync_map.CompareAndSwap(m, k, v, r.Intn(4))
+		case 5:
+			sync_map.CompareAndDelete(m, k, v)
+		default:
+			m.Load(k)
+		}
+		if hookErr != nil {
+			t.Fatalf("after %d operations: %v", i, hookErr)
+		}
+	}
+	if got := mapContents(m); !reflect.DeepEqual(got, mirror) {
+		t.Errorf("Map holds %v, but hooks mirrored %v", got, mirror)
+	}
+}
+
+func TestWithHooksTypeMismatch(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Errorf("NewMap with hooks of the wrong type did not panic")
+			return
+		}
+		if msg := fmt.Sprint(r); !strings.Contains(msg, "Map[fmt.Stringer, interface {}]") {
+			t.Errorf("NewMap with hooks of the wrong type panicked with %q; want the Map's types", msg)
+		}
+	}()
+	sync_map.NewMap[fmt.Stringer, any](sync_map.WithHooks(sync_map.Hooks[string, int]{}))
+}
+
+// BenchmarkWriteFastPaths measures the lock-free paths of Store, Swap and
+// Delete on a zero Map, which has no hooks, watchers or waiters to notify.
+func BenchmarkWriteFastPaths(b *testing.B) {
+	const keys = 1024
+	newMap := func() *sync_map.Map[int, int] {
+		m := new(sync_map.Map[int, int])
+		for i := 0; i < keys; i++ {
+			m.Store(i, i)
+		}
+		m.Range(func(int, int) bool { return true }) // Promote the dirty map.
+		return m
+	}
+
+	b.Run("Store", func(b *testing.B) {
+		m := newMap()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.Store(i%keys, i)
+		}
+	})
+	b.Run("Swap", func(b *testing.B) {
+		m := newMap()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.Swap(i%keys, i)
+		}
+	})
+	b.Run("DeleteAndStore", func(b *testing.B) {
+		// Deleted keys keep their entries in the read map, so both the delete
+		// and the store of the new value take the fast path.
+		m := newMap()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.Delete(i % keys)
+			m.Store(i%keys, i)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package sync_map
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// MarshalJSON implements [encoding/json.Marshaler].
+//
+// The map is encoded as a JSON object, following the rules encoding/json uses
+// for Go maps: the key type must be a string type, an integer type, or
+// implement [encoding.TextMarshaler]. Unlike encoding/json, MarshalJSON does
+// not sort the keys.
+//
+// The entries are visited with [Map.Range], so the result does not
+// necessarily correspond to any consistent snapshot of the Map's contents if
+// it is modified concurrently.
+func (m *Map[K, V]) MarshalJSON() ([]byte, error) {
+	kt := reflect.TypeOf((*K)(nil)).Elem()
+	switch kt.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		if !kt.Implements(textMarshalerType) {
+			return nil, &json.UnsupportedTypeError{Type: reflect.TypeOf(m)}
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	buf.WriteByte('{')
+	m.Range(func(key K, value V) bool {
+		var ks string
+		if ks, err = marshalKey(reflect.ValueOf(&key).Elem()); err != nil {
+			return false
+		}
+		var b []byte
+		if b, err = json.Marshal(ks); err != nil {
+			return false
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(b)
+		buf.WriteByte(':')
+		if b, err = json.Marshal(value); err != nil {
+			return false
+		}
+		buf.Write(b)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshalKey returns the JSON object key for k, as encoding/json does.
+func marshalKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Pointer && k.IsNil() {
+			return "", nil
+		}
+		buf, err := tm.MarshalText()
+		return string(buf), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	panic("unexpected map key type")
+}
+
+// UnmarshalJSON implements [encoding/json.Unmarshaler].
+//
+// The data must be a JSON object or null. Each member of the object is
+// decoded and stored in the map as it is read, following the rules
+// encoding/json uses for Go maps; entries already in the map are kept unless
+// the object replaces them. If an error is returned, the members decoded
+// before the error have already been stored.
+func (m *Map[K, V]) UnmarshalJSON(data []byte) error {
+	kt := reflect.TypeOf((*K)(nil)).Elem()
+	switch kt.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		if !reflect.PointerTo(kt).Implements(textUnmarshalerType) {
+			return &json.UnmarshalTypeError{Value: "object", Type: reflect.TypeOf(m)}
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		// Like encoding/json, treat null as a no-op.
+		return nil
+	}
+	if tok != json.Delim('{') {
+		return &json.UnmarshalTypeError{Value: jsonValueKind(tok), Type: reflect.TypeOf(m), Offset: dec.InputOffset()}
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var key K
+		if err := unmarshalKey(reflect.ValueOf(&key).Elem(), tok.(string)); err != nil {
+			if ute, ok := err.(*json.UnmarshalTypeError); ok {
+				ute.Offset = dec.InputOffset()
+			}
+			return err
+		}
+		var value V
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		m.Store(key, value)
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// unmarshalKey sets k from the JSON object key s, as encoding/json does.
+func unmarshalKey(k reflect.Value, s string) error {
+	if reflect.PointerTo(k.Type()).Implements(textUnmarshalerType) {
+		return k.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch k.Kind() {
+	case reflect.String:
+		k.SetString(s)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || k.OverflowInt(n) {
+			return &json.UnmarshalTypeError{Value: "number " + s, Type: k.Type()}
+		}
+		k.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || k.OverflowUint(n) {
+			return &json.UnmarshalTypeError{Value: "number " + s, Type: k.Type()}
+		}
+		k.SetUint(n)
+		return nil
+	}
+	panic("unexpected map key type")
+}
+
+// jsonValueKind describes the JSON value that starts with tok, for
+// UnmarshalTypeError.
+func jsonValueKind(tok json.Token) string {
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' {
+			return "array"
+		}
+	case bool:
+		return "bool"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	}
+	return fmt.Sprint(tok)
+}
@@ -0,0 +1,139 @@
+package sync_map_test
+
+import (
+	"encoding/json"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+type jsonKey string
+
+type jsonValue struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// checkJSONRoundTrip checks that m encodes like the equivalent Go map and
+// decodes back to the same contents.
+func checkJSONRoundTrip[K comparable, V any](t *testing.T, entries map[K]V) {
+	t.Helper()
+
+	m := new(sync_map.Map[K, V])
+	for k, v := range entries {
+		m.Store(k, v)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("json.Marshal(%T) failed: %v", m, err)
+	}
+
+	// encoding/json sorts map keys and Map does not, so compare the decoded
+	// forms rather than the encodings.
+	var fromMap, fromGoMap map[string]any
+	goData, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatalf("json.Marshal(%T) failed: %v", entries, err)
+	}
+	if err := json.Unmarshal(data, &fromMap); err != nil {
+		t.Fatalf("json.Unmarshal(%s) failed: %v", data, err)
+	}
+	if err := json.Unmarshal(goData, &fromGoMap); err != nil {
+		t.Fatalf("json.Unmarshal(%s) failed: %v", goData, err)
+	}
+	if !reflect.DeepEqual(fromMap, fromGoMap) {
+		t.Errorf("%T encoded as %s; want %s", m, data, goData)
+	}
+
+	decoded := new(sync_map.Map[K, V])
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("json.Unmarshal(%s) failed: %v", data, err)
+	}
+	got := map[K]V{}
+	decoded.Range(func(k K, v V) bool {
+		got[k] = v
+		return true
+	})
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("round trip of %v through %s produced %v", entries, data, got)
+	}
+}
+
+func TestMapJSONRoundTrip(t *testing.T) {
+	checkJSONRoundTrip(t, map[string]int{})
+	checkJSONRoundTrip(t, map[string]int{"a": 1, "b": 2, "<&>": 3})
+	checkJSONRoundTrip(t, map[jsonKey]jsonValue{"x": {Name: "x", Tags: []string{"t"}}, "y": {Name: "y"}})
+	checkJSONRoundTrip(t, map[int]string{-1: "minus one", 0: "zero", 42: "forty-two"})
+	checkJSONRoundTrip(t, map[uint8]bool{0: false, 255: true})
+	checkJSONRoundTrip(t, map[netip.Addr]string{
+		netip.MustParseAddr("127.0.0.1"): "localhost",
+		netip.MustParseAddr("::1"):       "localhost6",
+	})
+}
+
+func TestMapJSONSingleEntryMatchesEncodingJSON(t *testing.T) {
+	var m sync_map.Map[int, []string]
+	m.Store(7, []string{"a", "b"})
+	got, err := json.Marshal(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(map[int][]string{7: {"a", "b"}})
+	if string(got) != string(want) {
+		t.Errorf("json.Marshal = %s; want %s", got, want)
+	}
+}
+
+func TestMapJSONUnmarshalKeepsEntries(t *testing.T) {
+	var m sync_map.Map[string, int]
+	m.Store("a", 1)
+	m.Store("b", 2)
+	if err := json.Unmarshal([]byte(`{"b": 20, "c": 30}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`null`), &m); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"a": 1, "b": 20, "c": 30}
+	got := map[string]int{}
+	m.Range(func(k string, v int) bool {
+		got[k] = v
+		return true
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after json.Unmarshal, map contains %v; want %v", got, want)
+	}
+}
+
+func TestMapJSONErrors(t *testing.T) {
+	type structKey struct{ A int }
+	var sm sync_map.Map[structKey, int]
+	sm.Store(structKey{1}, 1)
+	if _, err := json.Marshal(&sm); err == nil {
+		t.Errorf("json.Marshal of a Map with struct keys succeeded")
+	}
+	if err := json.Unmarshal([]byte(`{}`), &sm); err == nil {
+		t.Errorf("json.Unmarshal into a Map with struct keys succeeded")
+	}
+
+	var im sync_map.Map[int8, int]
+	for _, data := range []string{
+		`{"1000": 1}`,
+		`{"x": 1}`,
+		`[1, 2]`,
+		`{"1": "one"}`,
+		`{"1": 1`,
+	} {
+		if err := json.Unmarshal([]byte(data), &im); err == nil {
+			t.Errorf("json.Unmarshal(%s) into Map[int8, int] succeeded", data)
+		}
+	}
+
+	var vm sync_map.Map[string, func()]
+	vm.Store("f", func() {})
+	if _, err := json.Marshal(&vm); err == nil {
+		t.Errorf("json.Marshal of a Map with func values succeeded")
+	}
+}
@@ -24,7 +24,8 @@ import (
 // sets of keys. In these two cases, use of a Map may significantly reduce lock
 // contention compared to a Go map paired with a separate [Mutex] or [RWMutex].
 //
-// The zero Map is empty and ready for use. A Map must not be copied after first use.
+// The zero Map is empty and ready for use. [NewMap] creates a Map with
+// non-default options. A Map must not be copied after first use.
 //
 // In the terminology of [the Go memory model], Map arranges that a write operation
 // “synchronizes before” any read operation that observes the effect of the write, where
@@ -67,6 +68,40 @@ type Map[K comparable, V any] struct {
 	// map, the dirty map will be promoted to the read map (in the unamended
 	// state) and the next store to the map will make a new dirty copy.
 	misses int
+
+	// promote decides when enough misses have occurred. If nil, the dirty map
+	// is promoted once misses reaches len(dirty).
+	promote PromotionPolicy
+
+	// stats holds the counters reported by Stats, or nil if the Map was not
+	// created with WithStats.
+	stats *mapCounters
+
+	// observed is set once the Map has hooks, watchers or waiters, before
+	// any of them is set, so that changes to a Map without any skip
+	// notifying them after a single load.
+	observed atomic.Bool
+
+	// hooks holds the functions called after the map's contents change, or
+	// nil if the Map was not created with WithHooks.
+	hooks *Hooks[K, V]
+
+	// watch holds the watchers registered by Watch and WatchAll, or nil if
+	// there have never been any.
+	watch atomic.Pointer[watchRegistry[K, V]]
+
+	// wait holds the goroutines waiting in LoadWait, or nil if LoadWait has
+	// never had to wait.
+	wait atomic.Pointer[waitRegistry[K]]
+
+	// once holds the calls in progress in LoadOrComputeOnce, or nil if
+	// LoadOrComputeOnce has never been called for a missing key.
+	once atomic.Pointer[onceCalls[K, V]]
+
+	// count is the number of entries with a live value. It is adjusted after
+	// each operation that changes an entry between deleted (nil or expunged)
+	// and live, so it may briefly lag behind concurrent operations.
+	count atomic.Int64
 }
 
 // readOnly is an immutable struct stored atomically in the Map.read field.
@@ -90,12 +125,20 @@ type entry[V any] struct {
 	// m.dirty[key] is e.
 	//
 	// If p == expunged, the entry has been deleted, m.dirty != nil, and the entry
-	// is missing from m.dirty.
+	// is missing from m.dirty. Clear and Compact also expunge entries that they
+	// remove from m.read, so that operations still holding the old read map
+	// retry with mu held rather than updating an unreachable entry.
+	//
+	// If p == locked, a transaction holding mu is committing the entry (or, in
+	// pessimistic mode, has accessed it), or Snapshot or Clone holding mu is
+	// reading it. They replace locked with a value, nil or expunged before
+	// they unlock mu, so operations that find it without holding mu wait for
+	// mu.
 	//
 	// Otherwise, the entry is valid and recorded in m.read.m[key] and, if m.dirty
 	// != nil, in m.dirty[key].
 	//
-	// If p != expunged, it is always safe to cast it to (*V).
+	// If p != expunged and p != locked, it is always safe to cast it to (*V).
 	//
 	// An entry can be deleted by atomic replacement with nil: when m.dirty is
 	// next created, it will atomically replace nil with expunged and leave
@@ -129,6 +172,7 @@ func (m *Map[K, V]) Load(key K) (value V, ok bool) {
 	e, ok := read.m[key]
 	if !ok && read.amended {
 		m.mu.Lock()
+		m.slowPathLocked(slowLoad)
 		// Avoid reporting a spurious miss if m.dirty got promoted while we were
 		// blocked on m.mu. (If further loads of the same key will not miss, it's
 		// not worth copying the dirty map for this key.)
@@ -146,17 +190,90 @@ func (m *Map[K, V]) Load(key K) (value V, ok bool) {
 	if !ok {
 		return value, false
 	}
-	return e.load()
+	return m.loadEntry(e)
 }
 
-func (e *entry[V]) load() (value V, ok bool) {
+// loadEntry loads the value of e, waiting for a transaction that has locked e.
+func (m *Map[K, V]) loadEntry(e *entry[V]) (value V, ok bool) {
 	p := atomic.LoadPointer(&e.p)
 	if p == nil || p == expunged {
 		return value, false
 	}
+	if p == locked {
+		return m.loadEntrySlow(e)
+	}
 	return *(*V)(p), true
 }
 
+// loadEntrySlow is the slow path of loadEntry, kept out of line so that
+// loadEntry can be inlined.
+//
+//go:noinline
+func (m *Map[K, V]) loadEntrySlow(e *entry[V]) (value V, ok bool) {
+	p := atomic.LoadPointer(&e.p)
+	for p == locked {
+		m.awaitTxn()
+		p = atomic.LoadPointer(&e.p)
+	}
+	if p == nil || p == expunged {
+		return value, false
+	}
+	return *(*V)(p), true
+}
+
+// LoadMany loads the values for a batch of keys, storing the value for
+// keys[i] in out[i], or the zero value if no value is present. The result
+// reports, for each key, whether its value was found in the map. LoadMany
+// panics if out is shorter than keys.
+//
+// Each key is loaded as if by [Map.Load], but the keys that are not in the
+// read map share a single acquisition of the map's lock.
+func (m *Map[K, V]) LoadMany(keys []K, out []V) []bool {
+	if len(out) < len(keys) {
+		panic("sync_map: LoadMany with len(out) < len(keys)")
+	}
+	found := make([]bool, len(keys))
+	var missed []int
+	read := m.loadReadOnly()
+	for i, key := range keys {
+		if e, ok := read.m[key]; ok {
+			out[i], found[i] = m.loadEntry(e)
+		} else if read.amended {
+			missed = append(missed, i)
+		} else {
+			out[i] = *new(V)
+		}
+	}
+	if len(missed) == 0 {
+		return found
+	}
+
+	entries := make([]*entry[V], len(missed))
+	m.mu.Lock()
+	m.slowPathLocked(slowLoad)
+	for j, i := range missed {
+		// A miss may promote the dirty map, so reload the read map for each
+		// key.
+		read = m.loadReadOnly()
+		e, ok := read.m[keys[i]]
+		if !ok && read.amended {
+			e = m.dirty[keys[i]]
+			m.missLocked()
+		}
+		entries[j] = e
+	}
+	m.mu.Unlock()
+
+	for j, i := range missed {
+		if e := entries[j]; e != nil {
+			out[i], found[i] = m.loadEntry(e)
+		} else {
+			out[i] = *new(V)
+		}
+	}
+	return found
+}
+
 // Store sets the value for a key.
 func (m *Map[K, V]) Store(key K, value V) {
 	_, _ = m.Swap(key, value)
@@ -186,11 +303,17 @@ func (m *Map[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
 	if e, ok := read.m[key]; ok {
 		actual, loaded, ok := e.tryLoadOrStore(value)
 		if ok {
+			if !loaded {
+				m.count.Add(1)
+				var zero V
+				m.afterStore(key, zero, false, value)
+			}
 			return actual, loaded
 		}
 	}
 
 	m.mu.Lock()
+	m.slowPathLocked(slowLoadOrStore)
 	read = m.loadReadOnly()
 	if e, ok := read.m[key]; ok {
 		if e.unexpungeLocked() {
@@ -212,17 +335,22 @@ func (m *Map[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
 	}
 	m.mu.Unlock()
 
+	if !loaded {
+		m.count.Add(1)
+		var zero V
+		m.afterStore(key, zero, false, value)
+	}
 	return actual, loaded
 }
 
 // tryLoadOrStore atomically loads or stores a value if the entry is not
-// expunged.
+// expunged or locked.
 //
-// If the entry is expunged, tryLoadOrStore leaves the entry unchanged and
-// returns with ok==false.
+// If the entry is expunged or locked, tryLoadOrStore leaves the entry
+// unchanged and returns with ok==false.
 func (e *entry[V]) tryLoadOrStore(i V) (actual V, loaded, ok bool) {
 	ptr := atomic.LoadPointer(&e.p)
-	if ptr == expunged {
+	if ptr == expunged || ptr == locked {
 		return actual, false, false
 	}
 	p := (*V)(ptr)
@@ -239,7 +367,7 @@ func (e *entry[V]) tryLoadOrStore(i V) (actual V, loaded, ok bool) {
 			return i, false, true
 		}
 		ptr = atomic.LoadPointer(&e.p)
-		if ptr == expunged {
+		if ptr == expunged || ptr == locked {
 			return actual, false, false
 		}
 		p = (*V)(ptr)
@@ -256,6 +384,7 @@ func (m *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
 	e, ok := read.m[key]
 	if !ok && read.amended {
 		m.mu.Lock()
+		m.slowPathLocked(slowLoadAndDelete)
 		read = m.loadReadOnly()
 		e, ok = read.m[key]
 		if !ok && read.amended {
@@ -269,7 +398,12 @@ func (m *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
 		m.mu.Unlock()
 	}
 	if ok {
-		return e.delete()
+		value, loaded = m.deleteEntry(e)
+		if loaded {
+			m.count.Add(-1)
+			m.afterDelete(key, value)
+		}
+		return value, loaded
 	}
 	return value, false
 }
@@ -279,9 +413,15 @@ func (m *Map[K, V]) Delete(key K) {
 	m.LoadAndDelete(key)
 }
 
-func (e *entry[V]) delete() (value V, ok bool) {
+// deleteEntry deletes the value of e, waiting for a transaction that has
+// locked e.
+func (m *Map[K, V]) deleteEntry(e *entry[V]) (value V, ok bool) {
 	for {
 		p := atomic.LoadPointer(&e.p)
+		if p == locked {
+			m.awaitTxn()
+			continue
+		}
 		if p == nil || p == expunged {
 			return value, false
 		}
@@ -291,14 +431,14 @@ func (e *entry[V]) delete() (value V, ok bool) {
 	}
 }
 
-// trySwap swaps a value if the entry has not been expunged.
+// trySwap swaps a value if the entry has not been expunged or locked.
 //
-// If the entry is expunged, trySwap returns false and leaves the entry
-// unchanged.
+// If the entry is expunged or locked, trySwap returns false and leaves the
+// entry unchanged.
 func (e *entry[V]) trySwap(i *V) (*V, bool) {
 	for {
 		p := atomic.LoadPointer(&e.p)
-		if p == expunged {
+		if p == expunged || p == locked {
 			return nil, false
 		}
 		if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(i)) {
@@ -314,13 +454,17 @@ func (m *Map[K, V]) Swap(key K, value V) (previous V, loaded bool) {
 	if e, ok := read.m[key]; ok {
 		if v, ok := e.trySwap(&value); ok {
 			if v == nil {
+				m.count.Add(1)
+				m.afterStore(key, previous, false, value)
 				return previous, false
 			}
+			m.afterStore(key, *v, true, value)
 			return *v, true
 		}
 	}
 
 	m.mu.Lock()
+	m.slowPathLocked(slowSwap)
 	read = m.loadReadOnly()
 	if e, ok := read.m[key]; ok {
 		if e.unexpungeLocked() {
@@ -347,9 +491,163 @@ func (m *Map[K, V]) Swap(key K, value V) (previous V, loaded bool) {
 		m.dirty[key] = newEntry(value)
 	}
 	m.mu.Unlock()
+
+	if !loaded {
+		m.count.Add(1)
+	}
+	m.afterStore(key, previous, loaded, value)
 	return previous, loaded
 }
 
+// ComputeOp tells [Map.Compute] what to do with the value returned by its
+// callback.
+type ComputeOp int
+
+const (
+	// UpdateOp stores the new value for the key.
+	UpdateOp ComputeOp = iota
+	// DeleteOp deletes the key, if it is present.
+	DeleteOp
+	// CancelOp leaves the map unchanged.
+	CancelOp
+)
+
+// Compute atomically computes the value for a key from its current value.
+//
+// f is called with the current value for key and whether it was present, and
+// returns the new value along with the operation to apply: [UpdateOp] stores
+// the new value, [DeleteOp] deletes the key and [CancelOp] leaves the entry as
+// it was. The actual result is the value stored for key after the operation,
+// and ok reports whether the key is present.
+//
+// If the entry is modified concurrently, f may be called more than once; only
+// the result of the last call is applied. f may be called while internal locks
+// are held, so it must not call any method on m.
+func (m *Map[K, V]) Compute(key K, f func(old V, loaded bool) (new V, op ComputeOp)) (actual V, ok bool) {
+	read := m.loadReadOnly()
+	if e, ok := read.m[key]; ok {
+		if old, actual, op, loaded, done := e.tryCompute(f); done {
+			return m.computed(key, old, actual, op, loaded)
+		}
+	}
+
+	var old V
+	var op ComputeOp
+	var loaded bool
+	m.mu.Lock()
+	m.slowPathLocked(slowCompute)
+	read = m.loadReadOnly()
+	if e, found := read.m[key]; found {
+		if e.unexpungeLocked() {
+			m.dirty[key] = e
+		}
+		old, actual, op, loaded, _ = e.tryCompute(f)
+	} else if e, found := m.dirty[key]; found {
+		old, actual, op, loaded, _ = e.tryCompute(f)
+		m.missLocked()
+	} else {
+		var v V
+		if v, op = f(old, false); op == UpdateOp {
+			if !read.amended {
+				// We're adding the first new key to the dirty map.
+				// Make sure it is allocated and mark the read-only map as incomplete.
+				m.dirtyLocked()
+				m.read.Store(&readOnly[K, V]{m: read.m, amended: true})
+			}
+			m.dirty[key] = newEntry(v)
+			actual = v
+		} else {
+			op = CancelOp
+		}
+	}
+	m.mu.Unlock()
+
+	return m.computed(key, old, actual, op, loaded)
+}
+
+// computed finishes a call to Compute that applied op to an entry, returning
+// Compute's results.
+func (m *Map[K, V]) computed(key K, old, actual V, op ComputeOp, loaded bool) (V, bool) {
+	switch op {
+	case UpdateOp:
+		m.updateCount(loaded, true)
+		m.afterStore(key, old, loaded, actual)
+		return actual, true
+	case DeleteOp:
+		m.updateCount(true, false)
+		m.afterDelete(key, old)
+		return actual, false
+	default:
+		return actual, loaded
+	}
+}
+
+// tryCompute applies f to the entry if the entry is not expunged or locked. It returns
+// the entry's value before and after the operation, and the operation that
+// was applied: a DeleteOp of an entry without a value is reported as a
+// CancelOp. The loaded result reports whether the entry held a value before
+// the operation.
+//
+// If the entry is expunged or locked, tryCompute leaves the entry unchanged
+// and returns with done==false.
+func (e *entry[V]) tryCompute(f func(old V, loaded bool) (V, ComputeOp)) (old, actual V, op ComputeOp, loaded, done bool) {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == expunged || p == locked {
+			return old, actual, CancelOp, false, false
+		}
+		loaded = p != nil
+		if loaded {
+			old = *(*V)(p)
+		} else {
+			old = *new(V)
+		}
+		var v V
+		v, op = f(old, loaded)
+		switch op {
+		case UpdateOp:
+			if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(&v)) {
+				return old, v, UpdateOp, loaded, true
+			}
+		case DeleteOp:
+			if !loaded {
+				return old, actual, CancelOp, false, true
+			}
+			if atomic.CompareAndSwapPointer(&e.p, p, nil) {
+				return old, actual, DeleteOp, true, true
+			}
+		default:
+			return old, old, CancelOp, loaded, true
+		}
+	}
+}
+
+// LoadOrCompute returns the existing value for the key if present.
+// Otherwise, it calls value, stores the result and returns it.
+// The loaded result is true if the value was loaded, false if stored.
+//
+// value is called at most once, and only if the key is missing. Like the
+// callback of [Map.Compute], it must not call any method on m.
+func (m *Map[K, V]) LoadOrCompute(key K, value func() V) (actual V, loaded bool) {
+	if v, ok := m.Load(key); ok {
+		return v, true
+	}
+
+	var computed V
+	var haveComputed bool
+	actual, _ = m.Compute(key, func(old V, ok bool) (V, ComputeOp) {
+		loaded = ok
+		if ok {
+			return old, CancelOp
+		}
+		if !haveComputed {
+			computed, haveComputed = value(), true
+		}
+		return computed, UpdateOp
+	})
+	return actual, loaded
+}
+
 // Range calls f sequentially for each key and value present in the map.
 // If f returns false, range stops the iteration.
 //
@@ -373,19 +671,13 @@ func (m *Map[K, V]) Range(f func(key K, value V) bool) {
 		// amortizes an entire copy of the map: we can promote the dirty copy
 		// immediately!
 		m.mu.Lock()
-		read = m.loadReadOnly()
-		if read.amended {
-			read = readOnly[K, V]{m: m.dirty}
-			copyRead := read
-			m.read.Store(&copyRead)
-			m.dirty = nil
-			m.misses = 0
-		}
+		m.slowPathLocked(slowRange)
+		read = m.promoteLocked()
 		m.mu.Unlock()
 	}
 
 	for k, e := range read.m {
-		v, ok := e.load()
+		v, ok := m.loadEntry(e)
 		if !ok {
 			continue
 		}
@@ -399,28 +691,95 @@ func (m *Map[K, V]) Range(f func(key K, value V) bool) {
 // if the value stored in the map is equal to old.
 // The old value must be of a comparable type.
 func CompareAndSwap[K comparable, V comparable](m *Map[K, V], key K, old, new V) (swapped bool) {
+	return m.compareAndSwap(key, new, func(p *V) bool { return *p == old })
+}
+
+// CompareAndSwapFunc swaps the old and new values for key
+// if eq reports that the value stored in the map is equal to old.
+// eq is called with the stored value and old, and may be called more than
+// once if the entry is modified concurrently.
+func CompareAndSwapFunc[K comparable, V any](m *Map[K, V], key K, old, new V, eq func(a, b V) bool) (swapped bool) {
+	return m.compareAndSwap(key, new, func(p *V) bool { return eq(*p, old) })
+}
+
+// LoadPointer returns a pointer to the value stored in the map for a key, or
+// nil if no value is present.
+// The ok result indicates whether value was found in the map.
+//
+// Every store allocates a new pointer, so unless V has size zero, the pointer
+// identifies the store as well as the value. Passing it to
+// [Map.CompareAndSwapPointer] or [Map.CompareAndDeletePointer] makes the
+// operation fail if the key has been stored since, even if it was stored with
+// an equal value. The value it points to must not be modified.
+func (m *Map[K, V]) LoadPointer(key K) (p *V, ok bool) {
 	read := m.loadReadOnly()
-	if e, ok := read.m[key]; ok {
-		return tryCompareAndSwap(e, old, new)
-	} else if !read.amended {
+	e, ok := read.m[key]
+	if !ok && read.amended {
+		m.mu.Lock()
+		m.slowPathLocked(slowLoad)
+		read = m.loadReadOnly()
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = m.dirty[key]
+			m.missLocked()
+		}
+		m.mu.Unlock()
+	}
+	if !ok {
+		return nil, false
+	}
+	ptr := atomic.LoadPointer(&e.p)
+	for ptr == locked {
+		m.awaitTxn()
+		ptr = atomic.LoadPointer(&e.p)
+	}
+	if ptr == nil || ptr == expunged {
+		return nil, false
+	}
+	return (*V)(ptr), true
+}
+
+// CompareAndSwapPointer swaps in new as the value for key if the value stored
+// in the map is still the one old points to, as returned by
+// [Map.LoadPointer].
+func (m *Map[K, V]) CompareAndSwapPointer(key K, old *V, new V) (swapped bool) {
+	return m.compareAndSwap(key, new, func(p *V) bool { return p == old })
+}
+
+// compareAndSwap swaps new into the entry for key if match reports true for
+// the entry's current value.
+func (m *Map[K, V]) compareAndSwap(key K, new V, match func(*V) bool) (swapped bool) {
+	var previous V
+	read := m.loadReadOnly()
+	e, ok := read.m[key]
+	if !ok && !read.amended {
 		return false // No existing value for key.
 	}
+	done := false
+	if ok {
+		previous, swapped, done = tryCompareAndSwap(e, new, match)
+	}
+	if !done {
+		m.mu.Lock()
+		m.slowPathLocked(slowCompareAndSwap)
+		read = m.loadReadOnly()
+		if e, ok := read.m[key]; ok {
+			previous, swapped, _ = tryCompareAndSwap(e, new, match)
+		} else if e, ok := m.dirty[key]; ok {
+			previous, swapped, _ = tryCompareAndSwap(e, new, match)
+			// We needed to lock mu in order to load the entry for key,
+			// and the operation didn't change the set of keys in the map
+			// (so it would be made more efficient by promoting the dirty
+			// map to read-only).
+			// Count it as a miss so that we will eventually switch to the
+			// more efficient steady state.
+			m.missLocked()
+		}
+		m.mu.Unlock()
+	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	read = m.loadReadOnly()
-	swapped = false
-	if e, ok := read.m[key]; ok {
-		swapped = tryCompareAndSwap(e, old, new)
-	} else if e, ok := m.dirty[key]; ok {
-		swapped = tryCompareAndSwap(e, old, new)
-		// We needed to lock mu in order to load the entry for key,
-		// and the operation didn't change the set of keys in the map
-		// (so it would be made more efficient by promoting the dirty
-		// map to read-only).
-		// Count it as a miss so that we will eventually switch to the
-		// more efficient steady state.
-		m.missLocked()
+	if swapped {
+		m.afterStore(key, previous, true, new)
 	}
 	return swapped
 }
@@ -431,10 +790,33 @@ func CompareAndSwap[K comparable, V comparable](m *Map[K, V], key K, old, new V)
 // If there is no current value for key in the map, CompareAndDelete
 // returns false (even if the old value is the zero value of V).
 func CompareAndDelete[K comparable, V comparable](m *Map[K, V], key K, old V) (deleted bool) {
+	return m.compareAndDelete(key, func(p *V) bool { return *p == old })
+}
+
+// CompareAndDeleteFunc deletes the entry for key if eq reports that its value
+// is equal to old. eq is called with the stored value and old, and may be
+// called more than once if the entry is modified concurrently.
+//
+// If there is no current value for key in the map, CompareAndDeleteFunc
+// returns false without calling eq.
+func CompareAndDeleteFunc[K comparable, V any](m *Map[K, V], key K, old V, eq func(a, b V) bool) (deleted bool) {
+	return m.compareAndDelete(key, func(p *V) bool { return eq(*p, old) })
+}
+
+// CompareAndDeletePointer deletes the entry for key if its value is still the
+// one old points to, as returned by [Map.LoadPointer].
+func (m *Map[K, V]) CompareAndDeletePointer(key K, old *V) (deleted bool) {
+	return m.compareAndDelete(key, func(p *V) bool { return p == old })
+}
+
+// compareAndDelete deletes the entry for key if match reports true for the
+// entry's current value.
+func (m *Map[K, V]) compareAndDelete(key K, match func(*V) bool) (deleted bool) {
 	read := m.loadReadOnly()
 	e, ok := read.m[key]
 	if !ok && read.amended {
 		m.mu.Lock()
+		m.slowPathLocked(slowCompareAndDelete)
 		read = m.loadReadOnly()
 		e, ok = read.m[key]
 		if !ok && read.amended {
@@ -452,34 +834,44 @@ func CompareAndDelete[K comparable, V comparable](m *Map[K, V], key K, old V) (d
 	}
 	for ok {
 		ptr := atomic.LoadPointer(&e.p)
+		if ptr == locked {
+			m.awaitTxn()
+			continue
+		}
 		if ptr == nil || ptr == expunged {
 			return false
 		}
 		p := (*V)(ptr)
-		if *p != old {
+		if !match(p) {
 			return false
 		}
 		if atomic.CompareAndSwapPointer(&e.p, ptr, nil) {
+			m.count.Add(-1)
+			m.afterDelete(key, *p)
 			return true
 		}
 	}
 	return false
 }
 
-// tryCompareAndSwap compare the entry with the given old value and swaps
-// it with a new value if the entry is equal to the old value, and the entry
-// has not been expunged.
+// tryCompareAndSwap swaps the entry's value with new if match reports true
+// for its current value, and the entry has not been expunged. It returns the
+// value that was replaced.
 //
 // If the entry is expunged, tryCompareAndSwap returns false and leaves
-// the entry unchanged.
-func tryCompareAndSwap[V comparable](e *entry[V], old, new V) bool {
+// the entry unchanged. If the entry is locked, it also returns with
+// done==false.
+func tryCompareAndSwap[V any](e *entry[V], new V, match func(*V) bool) (previous V, swapped, done bool) {
 	ptr := atomic.LoadPointer(&e.p)
+	if ptr == locked {
+		return previous, false, false
+	}
 	if ptr == nil || ptr == expunged {
-		return false
+		return previous, false, true
 	}
 	p := (*V)(ptr)
-	if *p != old {
-		return false
+	if !match(p) {
+		return previous, false, true
 	}
 
 	// Copy the interface after the first load to make this method more amenable
@@ -488,27 +880,123 @@ func tryCompareAndSwap[V comparable](e *entry[V], old, new V) bool {
 	nc := new
 	for {
 		if atomic.CompareAndSwapPointer(&e.p, ptr, unsafe.Pointer(&nc)) {
-			return true
+			return *p, true, true
 		}
 		ptr = atomic.LoadPointer(&e.p)
+		if ptr == locked {
+			return previous, false, false
+		}
 		if ptr == nil || ptr == expunged {
-			return false
+			return previous, false, true
 		}
 		p = (*V)(ptr)
-		if *p != old {
-			return false
+		if !match(p) {
+			return previous, false, true
 		}
 	}
 }
 
+// Len returns the number of entries in the map.
+//
+// Len is maintained as entries are stored and deleted, so it runs in constant
+// time and does not promote the dirty map. Operations that are concurrent with
+// Len may or may not be reflected in its result.
+func (m *Map[K, V]) Len() int {
+	if n := m.count.Load(); n > 0 {
+		// The count may briefly go negative when an entry is deleted before the
+		// operation that stored it has recorded the store.
+		return int(n)
+	}
+	return 0
+}
+
+// updateCount adjusts the entry count after an operation that found an entry
+// present (or not) before and left it present (or not).
+func (m *Map[K, V]) updateCount(wasPresent, isPresent bool) {
+	if wasPresent == isPresent {
+		return
+	}
+	if isPresent {
+		m.count.Add(1)
+	} else {
+		m.count.Add(-1)
+	}
+}
+
 func (m *Map[K, V]) missLocked() {
 	m.misses++
-	if m.misses < len(m.dirty) {
+	if !m.shouldPromoteLocked() {
+		return
+	}
+	m.promoteLocked()
+}
+
+// Promote promotes the dirty map to the read map, so that loads of keys
+// stored since the last promotion take the fast path.
+//
+// A Map promotes its dirty map on its own once enough loads have missed the
+// read map, or when Range is called. Promote does so eagerly, for example
+// after loading a Map in bulk and before serving reads from it.
+func (m *Map[K, V]) Promote() {
+	if !m.loadReadOnly().amended {
 		return
 	}
-	m.read.Store(&readOnly[K, V]{m: m.dirty})
-	m.dirty = nil
-	m.misses = 0
+	m.mu.Lock()
+	m.promoteLocked()
+	m.mu.Unlock()
+}
+
+// promoteLocked promotes the dirty map to the read map if the read map is
+// amended, and returns the resulting read map.
+func (m *Map[K, V]) promoteLocked() readOnly[K, V] {
+	read := m.loadReadOnly()
+	if read.amended {
+		read = readOnly[K, V]{m: m.dirty}
+		copyRead := read
+		m.read.Store(&copyRead)
+		m.dirty = nil
+		m.misses = 0
+		if m.stats != nil {
+			m.stats.promotions++
+		}
+	}
+	return read
+}
+
+// Compact rebuilds the map's internal storage without the entries of deleted
+// keys.
+//
+// A deleted key keeps its slot in the read map until the next time a store
+// copies the read map to create a new dirty map, which may not happen for a
+// long time in a map that is only read and deleted from. Compact promotes the
+// dirty map, then replaces the read map with a copy holding only the keys that
+// are present, so that the memory for deleted keys (and the keys themselves)
+// can be reclaimed.
+//
+// Compact is O(N) with the number of keys in the map, and blocks other
+// operations that need to lock the map while it runs.
+func (m *Map[K, V]) Compact() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	read := m.promoteLocked()
+	live := make(map[K]*entry[V], m.Len())
+	for k, e := range read.m {
+		// Expunge deleted entries, so that operations that still hold the old
+		// read map take the slow path to store to them instead of reviving an
+		// entry that is no longer reachable.
+		if !e.tryExpungeLocked() {
+			live[k] = e
+		}
+	}
+	m.read.Store(&readOnly[K, V]{m: live})
+}
+
+func (m *Map[K, V]) shouldPromoteLocked() bool {
+	if m.promote == nil {
+		return m.misses >= len(m.dirty)
+	}
+	return m.promote(m.misses, len(m.dirty), len(m.loadReadOnly().m))
 }
 
 func (m *Map[K, V]) dirtyLocked() {
@@ -523,6 +1011,10 @@ func (m *Map[K, V]) dirtyLocked() {
 			m.dirty[k] = e
 		}
 	}
+	if m.stats != nil {
+		m.stats.dirtyCopies++
+		m.stats.dirtyCopied += uint64(len(m.dirty))
+	}
 }
 
 func (e *entry[V]) tryExpungeLocked() (isExpunged bool) {
@@ -2,7 +2,13 @@
 
 package sync_map_test
 
-import "testing"
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
 
 func BenchmarkClear(b *testing.B) {
 	benchMap(b, bench{
@@ -27,3 +33,109 @@ func BenchmarkClearInt(b *testing.B) {
 		},
 	})
 }
+
+// batchSizes are the batch sizes run by the benchmarks of batch operations.
+// A batch of 1 costs about as much as the corresponding single-key method.
+var batchSizes = []int{1, 16, 256}
+
+// BenchmarkStoreManyUnique is like BenchmarkLoadOrStoreUnique, but stores the
+// new keys in batches with StoreMany. Each op stores one key.
+func BenchmarkStoreManyUnique(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			var m sync_map.Map[int, int]
+			var id atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(id.Add(1)-1) * b.N
+				for more := true; more; {
+					m.StoreMany(func(yield func(int, int) bool) {
+						for n := 0; n < size; n++ {
+							if more = pb.Next(); !more || !yield(i, i) {
+								return
+							}
+							i++
+						}
+					})
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkDeleteManyUnique stores batches of new keys with StoreMany and
+// deletes them with DeleteMany before they are promoted. Each op stores and
+// deletes one key.
+func BenchmarkDeleteManyUnique(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			var m sync_map.Map[int, int]
+			var id atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(id.Add(1)-1) * b.N
+				keys := make([]int, 0, size)
+				for more := true; more; {
+					keys = keys[:0]
+					for len(keys) < size {
+						if more = pb.Next(); !more {
+							break
+						}
+						keys = append(keys, i)
+						i++
+					}
+					m.StoreMany(func(yield func(int, int) bool) {
+						for _, k := range keys {
+							if !yield(k, k) {
+								return
+							}
+						}
+					})
+					m.DeleteMany(func(yield func(int) bool) {
+						for _, k := range keys {
+							if !yield(k) {
+								return
+							}
+						}
+					})
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkLoadManyMostlyMisses loads batches of keys that are in the dirty
+// map, so that each batch locks the map once. Each op loads one key.
+func BenchmarkLoadManyMostlyMisses(b *testing.B) {
+	const dirty = 1 << 16
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			// A policy that never promotes keeps the keys in the dirty map.
+			m := sync_map.NewMap[int, int](sync_map.WithPromotionPolicy(func(int, int, int) bool { return false }))
+			m.StoreMany(func(yield func(int, int) bool) {
+				for k := 0; k < dirty; k++ {
+					if !yield(k, k) {
+						return
+					}
+				}
+			})
+			b.ResetTimer()
+
+			var id atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(id.Add(1)-1) * b.N
+				keys := make([]int, 0, size)
+				out := make([]int, size)
+				for more := true; more; {
+					keys = keys[:0]
+					for len(keys) < size {
+						if more = pb.Next(); !more {
+							break
+						}
+						keys = append(keys, i%dirty)
+						i++
+					}
+					m.LoadMany(keys, out)
+				}
+			})
+		})
+	}
+}
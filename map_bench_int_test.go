@@ -5,7 +5,6 @@
 package sync_map_test
 
 import (
-	"reflect"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -74,12 +73,23 @@ func (m *MapIntWrapper) CompareAndDelete(key, old int) (deleted bool) {
 	return m.m.CompareAndDelete(key, old)
 }
 
+// benchImplInt is a map implementation run by benchMapInt.
+type benchImplInt struct {
+	name string
+	new  func() casMapInterfaceInt // returns an empty instance
+}
+
+// benchMapsInt lists the implementations run by benchMapInt. Version-specific
+// test files may append to it.
+var benchMapsInt = []benchImplInt{
+	{"sync.MapWrapper", func() casMapInterfaceInt { return &MapIntWrapper{} }},
+	{"Map[int,int]", func() casMapInterfaceInt { return &CasMap[int, int]{} }},
+}
+
 func benchMapInt(b *testing.B, bench benchInt) {
-	maps := [...]casMapInterfaceInt{&MapIntWrapper{}, &CasMap[int, int]{}}
-	names := [...]string{"sync.MapWrapper", "Map[int,int]"}
-	for i, m := range maps {
-		b.Run(names[i], func(b *testing.B) {
-			m = reflect.New(reflect.TypeOf(m).Elem()).Interface().(casMapInterfaceInt)
+	for _, impl := range benchMapsInt {
+		b.Run(impl.name, func(b *testing.B) {
+			m := impl.new()
 			if bench.setup != nil {
 				bench.setup(b, m)
 			}
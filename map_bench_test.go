@@ -5,7 +5,6 @@
 package sync_map_test
 
 import (
-	"reflect"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -16,12 +15,25 @@ type bench struct {
 	perG  func(b *testing.B, pb *testing.PB, i int, m casMapInterface)
 }
 
+// benchImpl is a map implementation run by benchMap.
+type benchImpl struct {
+	name string
+	new  func() casMapInterface // returns an empty instance
+}
+
+// benchMaps lists the implementations run by benchMap. Version-specific test
+// files may append to it.
+var benchMaps = []benchImpl{
+	{"DeepCopyMap", func() casMapInterface { return &DeepCopyMap{} }},
+	{"RWMutexMap", func() casMapInterface { return &RWMutexMap{} }},
+	{"sync.Map", func() casMapInterface { return &sync.Map{} }},
+	{"Map[any,any]", func() casMapInterface { return &CasMap[any, any]{} }},
+}
+
 func benchMap(b *testing.B, bench bench) {
-	maps := [...]casMapInterface{&DeepCopyMap{}, &RWMutexMap{}, &sync.Map{}, &CasMap[any, any]{}}
-	names := [...]string{"DeepCopyMap", "RWMutexMap", "sync.Map", "Map[any,any]"}
-	for i, m := range maps {
-		b.Run(names[i], func(b *testing.B) {
-			m = reflect.New(reflect.TypeOf(m).Elem()).Interface().(casMapInterface)
+	for _, impl := range benchMaps {
+		b.Run(impl.name, func(b *testing.B) {
+			m := impl.new()
 			if bench.setup != nil {
 				bench.setup(b, m)
 			}
@@ -2,6 +2,11 @@
 
 package sync_map
 
+import (
+	"iter"
+	"sync/atomic"
+)
+
 // Clear deletes all the entries, resulting in an empty Map.
 func (m *Map[K, V]) Clear() {
 	read := m.loadReadOnly()
@@ -11,14 +16,279 @@ func (m *Map[K, V]) Clear() {
 	}
 
 	m.mu.Lock()
-	defer m.mu.Unlock()
 
 	read = m.loadReadOnly()
 	if len(read.m) > 0 || read.amended {
 		m.read.Store(&readOnly[K, V]{})
 	}
 
+	// Collect the removed entries for the OnDelete hook and the watchers, to
+	// report them once mu is unlocked.
+	var removed []clearedEntry[K, V]
+	onDelete := (m.hooks != nil && m.hooks.OnDelete != nil) || m.watch.Load() != nil
+
+	// Operations that loaded the previous read map may still reach its entries
+	// without holding mu. Expunge every entry so that those operations take the
+	// slow path and observe the cleared map, rather than storing into (or
+	// deleting from) an entry that is no longer reachable.
+	for k, e := range read.m {
+		if p := m.expungeClearedLocked(e); p != nil && onDelete {
+			removed = append(removed, clearedEntry[K, V]{k, *p})
+		}
+	}
+	for k, e := range m.dirty {
+		if p := m.expungeClearedLocked(e); p != nil && onDelete {
+			removed = append(removed, clearedEntry[K, V]{k, *p})
+		}
+	}
+
 	clear(m.dirty)
 	// Don't immediately promote the newly-cleared dirty map on the next operation.
 	m.misses = 0
+	m.mu.Unlock()
+
+	for _, r := range removed {
+		m.afterDelete(r.key, r.value)
+	}
+}
+
+type clearedEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// expungeClearedLocked marks an entry removed by Clear as expunged, adjusting
+// the entry count if it held a value. It returns the value, or nil if the
+// entry held none.
+func (m *Map[K, V]) expungeClearedLocked(e *entry[V]) *V {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == expunged {
+			return nil
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, expunged) {
+			if p != nil {
+				m.count.Add(-1)
+			}
+			return (*V)(p)
+		}
+	}
+}
+
+// Collect returns a Map configured by opts holding the keys and values of
+// seq. If seq yields a key more than once, the last value is kept.
+//
+// Like [FromMap], Collect builds the read map directly, so that loads of the
+// entries take the fast path immediately.
+func Collect[K comparable, V any](seq iter.Seq2[K, V], opts ...Option) *Map[K, V] {
+	read := make(map[K]*entry[V])
+	for k, v := range seq {
+		read[k] = newEntry(v)
+	}
+	return newLoadedMap(read, opts)
+}
+
+// batchSize is the largest number of keys that StoreMany and DeleteMany
+// handle with each acquisition of the map's lock. The iterators they are
+// given run without the lock held, so they may call methods on the map.
+const batchSize = 256
+
+// StoreMany sets the value for each key in seq, in order, as if by
+// [Map.Store].
+//
+// Keys that are already in the read map are stored without locking the map,
+// like Store. The others, such as new keys when bulk-loading the map, are
+// stored in batches that each lock the map once, rather than once per key.
+// A batched store takes effect when its batch is full or seq ends, so it may
+// not be visible to the rest of the iteration.
+func (m *Map[K, V]) StoreMany(seq iter.Seq2[K, V]) {
+	var batch []batchStore[K, V]
+	for key, value := range seq {
+		// Once a key is batched, batch the rest too, so that the stores take
+		// effect in order.
+		if len(batch) == 0 {
+			read := m.loadReadOnly()
+			if e, ok := read.m[key]; ok {
+				if v, ok := e.trySwap(&value); ok {
+					if v == nil {
+						m.count.Add(1)
+						var zero V
+						m.afterStore(key, zero, false, value)
+					} else {
+						m.afterStore(key, *v, true, value)
+					}
+					continue
+				}
+			}
+		}
+		batch = append(batch, batchStore[K, V]{key: key, value: value})
+		if len(batch) == batchSize {
+			m.storeBatch(batch)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		m.storeBatch(batch)
+	}
+}
+
+type batchStore[K comparable, V any] struct {
+	key      K
+	value    V
+	previous V
+	loaded   bool
+}
+
+// storeBatch stores each key and value in batch, as in the slow path of Swap,
+// with a single acquisition of mu.
+func (m *Map[K, V]) storeBatch(batch []batchStore[K, V]) {
+	added := 0
+	m.mu.Lock()
+	m.slowPathLocked(slowSwap)
+	read := m.loadReadOnly()
+	for i := range batch {
+		b := &batch[i]
+		if e, ok := read.m[b.key]; ok {
+			if e.unexpungeLocked() {
+				// The entry was previously expunged, which implies that there
+				// is a non-nil dirty map and this entry is not in it.
+				m.dirty[b.key] = e
+			}
+			value := b.value
+			if v := e.swapLocked(&value); v != nil {
+				b.previous, b.loaded = *v, true
+			}
+		} else if e, ok := m.dirty[b.key]; ok {
+			value := b.value
+			if v := e.swapLocked(&value); v != nil {
+				b.previous, b.loaded = *v, true
+			}
+		} else {
+			if !read.amended {
+				// We're adding the first new key to the dirty map.
+				// Make sure it is allocated and mark the read-only map as
+				// incomplete.
+				m.dirtyLocked()
+				read.amended = true
+				m.read.Store(&readOnly[K, V]{m: read.m, amended: true})
+			}
+			m.dirty[b.key] = newEntry(b.value)
+		}
+		if !b.loaded {
+			added++
+		}
+	}
+	m.mu.Unlock()
+
+	m.count.Add(int64(added))
+	for i := range batch {
+		b := &batch[i]
+		m.afterStore(b.key, b.previous, b.loaded, b.value)
+		*b = batchStore[K, V]{}
+	}
+}
+
+// DeleteMany deletes the value for each key in keys, as if by [Map.Delete].
+//
+// Keys that are in the read map are deleted without locking the map, like
+// Delete. The others are deleted in batches that each lock the map once,
+// rather than once per key, and take effect like the batches of
+// [Map.StoreMany].
+func (m *Map[K, V]) DeleteMany(keys iter.Seq[K]) {
+	var batch []batchDelete[K, V]
+	for key := range keys {
+		read := m.loadReadOnly()
+		e, ok := read.m[key]
+		if ok {
+			if value, loaded := m.deleteEntry(e); loaded {
+				m.count.Add(-1)
+				m.afterDelete(key, value)
+			}
+			continue
+		}
+		if !ok && !read.amended {
+			continue // No value for key.
+		}
+		batch = append(batch, batchDelete[K, V]{key: key})
+		if len(batch) == batchSize {
+			m.deleteBatch(batch)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		m.deleteBatch(batch)
+	}
+}
+
+type batchDelete[K comparable, V any] struct {
+	key K
+	e   *entry[V]
+}
+
+// deleteBatch deletes each key in batch, as in the slow path of
+// LoadAndDelete, with a single acquisition of mu.
+func (m *Map[K, V]) deleteBatch(batch []batchDelete[K, V]) {
+	m.mu.Lock()
+	m.slowPathLocked(slowLoadAndDelete)
+	for i := range batch {
+		b := &batch[i]
+		// A miss may promote the dirty map, so reload the read map for each
+		// key.
+		read := m.loadReadOnly()
+		e, ok := read.m[b.key]
+		if !ok && read.amended {
+			e = m.dirty[b.key]
+			delete(m.dirty, b.key)
+			// Regardless of whether the entry was present, record a miss:
+			// this key will take the slow path until the dirty map is
+			// promoted to the read map.
+			m.missLocked()
+		}
+		b.e = e
+	}
+	m.mu.Unlock()
+
+	for i := range batch {
+		b := &batch[i]
+		if b.e != nil {
+			if value, loaded := m.deleteEntry(b.e); loaded {
+				m.count.Add(-1)
+				m.afterDelete(b.key, value)
+			}
+		}
+		*b = batchDelete[K, V]{}
+	}
+}
+
+// All returns an iterator over each key and value present in the map.
+//
+// The iterator has the same semantics as [Map.Range]: it does not necessarily
+// correspond to any consistent snapshot of the Map's contents, and starting an
+// iteration may promote the dirty map. The loop body may call any method on m.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.Range(yield)
+	}
+}
+
+// Keys returns an iterator over each key present in the map.
+//
+// The iterator has the same semantics as [Map.Range].
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.Range(func(key K, _ V) bool {
+			return yield(key)
+		})
+	}
+}
+
+// Values returns an iterator over each value present in the map.
+//
+// The iterator has the same semantics as [Map.Range].
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.Range(func(_ K, value V) bool {
+			return yield(value)
+		})
+	}
 }
@@ -5,6 +5,8 @@ package sync_map_test
 import (
 	"github.com/zolstein/sync-map"
 	"math/rand"
+	"reflect"
+	"runtime"
 	"sync"
 	"testing"
 )
@@ -143,6 +145,39 @@ func TestConcurrentClear(t *testing.T) {
 
 		return true
 	})
+	if n := m.Len(); n != 0 {
+		t.Errorf("after Clear, Len() = %v; expected 0", n)
+	}
+}
+
+func TestConcurrentClearLen(t *testing.T) {
+	var m sync_map.Map[int, int]
+
+	var wg sync.WaitGroup
+	for g := runtime.GOMAXPROCS(0); g > 0; g-- {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1<<10; i++ {
+				m.Store(i%64, i)
+				if i%3 == 0 {
+					m.Delete((i + g) % 64)
+				}
+				if i%128 == 0 {
+					m.Clear()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	n := 0
+	for range m.All() {
+		n++
+	}
+	if l := m.Len(); l != n {
+		t.Errorf("after concurrent Clear, Len() = %v; All visited %v entries", l, n)
+	}
 }
 
 func TestMapClearNoAllocations(t *testing.T) {
@@ -154,3 +189,203 @@ func TestMapClearNoAllocations(t *testing.T) {
 		t.Errorf("AllocsPerRun of m.Clear = %v; want 0", allocs)
 	}
 }
+
+func TestConcurrentAll(t *testing.T) {
+	const mapSize = 1 << 10
+
+	m := new(sync_map.Map[int64, int64])
+	for n := int64(1); n <= mapSize; n++ {
+		m.Store(n, int64(n))
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+	for g := int64(runtime.GOMAXPROCS(0)); g > 0; g-- {
+		r := rand.New(rand.NewSource(g))
+		wg.Add(1)
+		go func(g int64) {
+			defer wg.Done()
+			for i := int64(0); ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for n := int64(1); n < mapSize; n++ {
+					if r.Int63n(mapSize) == 0 {
+						m.Store(n, n*i*g)
+					} else {
+						m.Load(n)
+					}
+				}
+			}
+		}(g)
+	}
+
+	iters := 1 << 10
+	if testing.Short() {
+		iters = 16
+	}
+	for n := iters; n > 0; n-- {
+		seen := make(map[int64]bool, mapSize)
+		for k, v := range m.All() {
+			if v%k != 0 {
+				t.Fatalf("while Storing multiples of %v, All saw value %v", k, v)
+			}
+			if seen[k] {
+				t.Fatalf("All visited key %v twice", k)
+			}
+			seen[k] = true
+		}
+		if len(seen) != mapSize {
+			t.Fatalf("All visited %v elements of %v-element Map", len(seen), mapSize)
+		}
+
+		keys := 0
+		for k := range m.Keys() {
+			if k < 1 || k > mapSize {
+				t.Fatalf("Keys yielded unexpected key %v", k)
+			}
+			keys++
+		}
+		if keys != mapSize {
+			t.Fatalf("Keys visited %v elements of %v-element Map", keys, mapSize)
+		}
+
+		values := 0
+		for range m.Values() {
+			values++
+		}
+		if values != mapSize {
+			t.Fatalf("Values visited %v elements of %v-element Map", values, mapSize)
+		}
+	}
+}
+
+func TestMapAllNestedCall(t *testing.T) {
+	var m sync_map.Map[int, string]
+	for i, v := range [3]string{"hello", "world", "Go"} {
+		m.Store(i, v)
+	}
+	for key := range m.Keys() {
+		for key, value := range m.All() {
+			if v, ok := m.Load(key); !ok || v != value {
+				t.Fatalf("Nested All loads unexpected value, got %+v want %+v", v, value)
+			}
+			if _, loaded := m.LoadOrStore(42, "dummy"); loaded {
+				t.Fatalf("Nested All loads unexpected value, want store a new value")
+			}
+			val := "sync_map.Map"
+			m.Store(42, val)
+			if v, loaded := m.LoadAndDelete(42); !loaded || v != val {
+				t.Fatalf("Nested All loads unexpected value, got %v, want %v", v, val)
+			}
+		}
+		m.Delete(key)
+	}
+
+	length := 0
+	for range m.Values() {
+		length++
+	}
+	if length != 0 {
+		t.Fatalf("Unexpected sync_map.Map size, got %v want %v", length, 0)
+	}
+}
+
+func TestMapAllEarlyBreak(t *testing.T) {
+	var m sync_map.Map[int, int]
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+	n := 0
+	for range m.All() {
+		n++
+		if n == 3 {
+			break
+		}
+	}
+	if n != 3 {
+		t.Fatalf("All yielded %v elements after break; want 3", n)
+	}
+}
+
+func TestMapAllNoAllocations(t *testing.T) {
+	var m sync_map.Map[any, any]
+	allocs := testing.AllocsPerRun(10, func() {
+		for range m.All() {
+		}
+		for range m.Keys() {
+		}
+		for range m.Values() {
+		}
+	})
+	if allocs > 0 {
+		t.Errorf("AllocsPerRun of m.All, m.Keys and m.Values = %v; want 0", allocs)
+	}
+}
+
+func TestSetAllAndClear(t *testing.T) {
+	var s sync_map.Set[string]
+	for _, k := range []string{"a", "b", "c"} {
+		s.Add(k)
+	}
+	seen := map[string]bool{}
+	for k := range s.All() {
+		seen[k] = true
+	}
+	if len(seen) != 3 || !seen["a"] || !seen["b"] || !seen["c"] {
+		t.Fatalf("All yielded %v; want a, b and c", seen)
+	}
+
+	s.Clear()
+	if s.Len() != 0 || s.Contains("a") {
+		t.Fatalf("after Clear, set has %v keys", s.Len())
+	}
+}
+
+func TestMapClearHooks(t *testing.T) {
+	deleted := map[string]int{}
+	m := sync_map.NewMap[string, int](sync_map.WithHooks(sync_map.Hooks[string, int]{
+		OnDelete: func(key string, old int) {
+			deleted[key] = old
+		},
+	}))
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Load("a")
+	m.Load("b") // Promote the dirty map.
+	m.Store("c", 3)
+	m.Delete("b")
+	delete(deleted, "b")
+
+	m.Clear()
+	if want := map[string]int{"a": 1, "c": 3}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("Clear called OnDelete for %v; want %v", deleted, want)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	m := sync_map.Collect(func(yield func(string, int) bool) {
+		_ = yield("a", 1) && yield("b", 2) && yield("a", 3)
+	}, sync_map.WithStats())
+	if want := map[string]int{"a": 3, "b": 2}; !reflect.DeepEqual(mapContents(m), want) {
+		t.Errorf("Collect built %v; want %v", mapContents(m), want)
+	}
+	if s := m.Stats(); s.Len != 2 || s.Amended || s.SlowPaths.Range != 0 {
+		t.Errorf("Stats() = %+v; want Len 2 and no dirty keys", s)
+	}
+
+	empty := sync_map.Collect(func(func(int, int) bool) {})
+	if empty.Len() != 0 {
+		t.Errorf("Collect of an empty sequence has Len %v", empty.Len())
+	}
+	empty.Store(1, 1)
+	if v, ok := empty.Load(1); !ok || v != 1 {
+		t.Errorf("Load(1) = %v, %v; want 1, true", v, ok)
+	}
+}
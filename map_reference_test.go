@@ -21,6 +21,12 @@ var (
 	_ casMapInterface = &DeepCopyMap{}
 	_ mapInterface    = &CasMap[any, any]{}
 	_ casMapInterface = &CasMap[any, any]{}
+
+	_ computeMapInterface = &RWMutexMap{}
+	_ computeMapInterface = &CasMap[any, any]{}
+
+	_ funcMapInterface = &RWMutexMap{}
+	_ funcMapInterface = &CasMap[any, any]{}
 )
 
 type CasMap[K comparable, V comparable] struct {
@@ -35,6 +41,14 @@ func (c *CasMap[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
 	return sync_map.CompareAndDelete(&c.Map, key, old)
 }
 
+func (c *CasMap[K, V]) CompareAndSwapFunc(key K, old, new V, eq func(a, b V) bool) (swapped bool) {
+	return sync_map.CompareAndSwapFunc(&c.Map, key, old, new, eq)
+}
+
+func (c *CasMap[K, V]) CompareAndDeleteFunc(key K, old V, eq func(a, b V) bool) (deleted bool) {
+	return sync_map.CompareAndDeleteFunc(&c.Map, key, old, eq)
+}
+
 // RWMutexMap is an implementation of mapInterface using a sync.RWMutex.
 type RWMutexMap struct {
 	mu    sync.RWMutex
@@ -131,6 +145,66 @@ func (m *RWMutexMap) CompareAndDelete(key, old any) (deleted bool) {
 	return false
 }
 
+func (m *RWMutexMap) CompareAndSwapFunc(key, old, new any, eq func(a, b any) bool) (swapped bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, loaded := m.dirty[key]
+	if loaded && eq(value, old) {
+		m.dirty[key] = new
+		return true
+	}
+	return false
+}
+
+func (m *RWMutexMap) CompareAndDeleteFunc(key, old any, eq func(a, b any) bool) (deleted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, loaded := m.dirty[key]
+	if loaded && eq(value, old) {
+		delete(m.dirty, key)
+		return true
+	}
+	return false
+}
+
+func (m *RWMutexMap) Compute(key any, f func(old any, loaded bool) (new any, op sync_map.ComputeOp)) (actual any, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, loaded := m.dirty[key]
+	new, op := f(old, loaded)
+	switch op {
+	case sync_map.UpdateOp:
+		if m.dirty == nil {
+			m.dirty = make(map[any]any)
+		}
+		m.dirty[key] = new
+		return new, true
+	case sync_map.DeleteOp:
+		delete(m.dirty, key)
+		return nil, false
+	default:
+		return old, loaded
+	}
+}
+
+func (m *RWMutexMap) LoadOrCompute(key any, value func() any) (actual any, loaded bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if actual, loaded = m.dirty[key]; loaded {
+		return actual, loaded
+	}
+	if m.dirty == nil {
+		m.dirty = make(map[any]any)
+	}
+	actual = value()
+	m.dirty[key] = actual
+	return actual, false
+}
+
 func (m *RWMutexMap) Range(f func(key, value any) (shouldContinue bool)) {
 	m.mu.RLock()
 	keys := make([]any, 0, len(m.dirty))
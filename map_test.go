@@ -5,6 +5,7 @@
 package sync_map_test
 
 import (
+	"bytes"
 	"math/rand"
 	"reflect"
 	"runtime"
@@ -12,6 +13,7 @@ import (
 	"sync/atomic"
 	"testing"
 	"testing/quick"
+	"time"
 
 	sync_map "github.com/zolstein/sync-map"
 )
@@ -101,6 +103,431 @@ func TestMapMatchesDeepCopy(t *testing.T) {
 	}
 }
 
+// computeMapInterface is the interface used to check Compute and LoadOrCompute.
+type computeMapInterface interface {
+	Load(key any) (value any, ok bool)
+	Store(key, value any)
+	Delete(any)
+	Compute(key any, f func(old any, loaded bool) (new any, op sync_map.ComputeOp)) (actual any, ok bool)
+	LoadOrCompute(key any, value func() any) (actual any, loaded bool)
+	Range(func(key, value any) (shouldContinue bool))
+}
+
+const (
+	opCompute       = mapOp("Compute")
+	opLoadOrCompute = mapOp("LoadOrCompute")
+)
+
+var computeOps = [...]mapOp{
+	opLoad,
+	opStore,
+	opDelete,
+	opCompute,
+	opLoadOrCompute,
+}
+
+// computeCall is a quick.Generator for calls on computeMapInterface.
+type computeCall struct {
+	op        mapOp
+	computeOp sync_map.ComputeOp
+	k, v      any
+}
+
+func (computeCall) Generate(r *rand.Rand, size int) reflect.Value {
+	c := computeCall{
+		op:        computeOps[rand.Intn(len(computeOps))],
+		computeOp: sync_map.ComputeOp(rand.Intn(3)),
+		k:         randValue(r),
+		v:         randValue(r),
+	}
+	return reflect.ValueOf(c)
+}
+
+func (c computeCall) apply(m computeMapInterface) (any, bool) {
+	switch c.op {
+	case opLoad:
+		return m.Load(c.k)
+	case opStore:
+		m.Store(c.k, c.v)
+		return nil, false
+	case opDelete:
+		m.Delete(c.k)
+		return nil, false
+	case opCompute:
+		return m.Compute(c.k, func(old any, loaded bool) (any, sync_map.ComputeOp) {
+			if loaded {
+				return old.(string) + c.v.(string), c.computeOp
+			}
+			return c.v, c.computeOp
+		})
+	case opLoadOrCompute:
+		return m.LoadOrCompute(c.k, func() any { return c.v })
+	default:
+		panic("invalid mapOp")
+	}
+}
+
+func applyComputeCalls(m computeMapInterface, calls []computeCall) (results []mapResult, final map[any]any) {
+	for _, c := range calls {
+		v, ok := c.apply(m)
+		results = append(results, mapResult{v, ok})
+	}
+
+	final = make(map[any]any)
+	m.Range(func(k, v any) bool {
+		final[k] = v
+		return true
+	})
+
+	return results, final
+}
+
+func TestComputeMatchesRWMutex(t *testing.T) {
+	applyMap := func(calls []computeCall) ([]mapResult, map[any]any) {
+		return applyComputeCalls(new(CasMap[any, any]), calls)
+	}
+	applyRWMutexMap := func(calls []computeCall) ([]mapResult, map[any]any) {
+		return applyComputeCalls(new(RWMutexMap), calls)
+	}
+	if err := quick.CheckEqual(applyMap, applyRWMutexMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// funcMapInterface is the interface used to check CompareAndSwapFunc and
+// CompareAndDeleteFunc.
+type funcMapInterface interface {
+	Load(key any) (value any, ok bool)
+	Store(key, value any)
+	Delete(any)
+	CompareAndSwapFunc(key, old, new any, eq func(a, b any) bool) (swapped bool)
+	CompareAndDeleteFunc(key, old any, eq func(a, b any) bool) (deleted bool)
+	Range(func(key, value any) (shouldContinue bool))
+}
+
+const (
+	opCompareAndSwapFunc   = mapOp("CompareAndSwapFunc")
+	opCompareAndDeleteFunc = mapOp("CompareAndDeleteFunc")
+)
+
+var funcOps = [...]mapOp{
+	opLoad,
+	opStore,
+	opDelete,
+	opCompareAndSwapFunc,
+	opCompareAndDeleteFunc,
+}
+
+// funcCall is a quick.Generator for calls on funcMapInterface. Its values are
+// byte slices, which are not comparable, drawn from a small set so that
+// comparisons often succeed.
+type funcCall struct {
+	op     mapOp
+	k      any
+	v, old []byte
+}
+
+func randSlice(r *rand.Rand) []byte {
+	return []byte("ab"[:r.Intn(3)])
+}
+
+func (funcCall) Generate(r *rand.Rand, size int) reflect.Value {
+	c := funcCall{
+		op:  funcOps[r.Intn(len(funcOps))],
+		k:   string(rune('a' + r.Intn(3))),
+		v:   randSlice(r),
+		old: randSlice(r),
+	}
+	return reflect.ValueOf(c)
+}
+
+func bytesEqual(a, b any) bool {
+	return bytes.Equal(a.([]byte), b.([]byte))
+}
+
+func (c funcCall) apply(m funcMapInterface) (any, bool) {
+	switch c.op {
+	case opLoad:
+		return m.Load(c.k)
+	case opStore:
+		m.Store(c.k, c.v)
+		return nil, false
+	case opDelete:
+		m.Delete(c.k)
+		return nil, false
+	case opCompareAndSwapFunc:
+		return nil, m.CompareAndSwapFunc(c.k, c.old, c.v, bytesEqual)
+	case opCompareAndDeleteFunc:
+		return nil, m.CompareAndDeleteFunc(c.k, c.old, bytesEqual)
+	default:
+		panic("invalid mapOp")
+	}
+}
+
+func applyFuncCalls(m funcMapInterface, calls []funcCall) (results []mapResult, final map[any]any) {
+	for _, c := range calls {
+		v, ok := c.apply(m)
+		results = append(results, mapResult{v, ok})
+	}
+
+	final = make(map[any]any)
+	m.Range(func(k, v any) bool {
+		final[k] = v
+		return true
+	})
+
+	return results, final
+}
+
+func TestCompareAndSwapFuncMatchesRWMutex(t *testing.T) {
+	applyMap := func(calls []funcCall) ([]mapResult, map[any]any) {
+		return applyFuncCalls(new(CasMap[any, any]), calls)
+	}
+	applyRWMutexMap := func(calls []funcCall) ([]mapResult, map[any]any) {
+		return applyFuncCalls(new(RWMutexMap), calls)
+	}
+	if err := quick.CheckEqual(applyMap, applyRWMutexMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// pointerMapInterface is the interface used to check the pointer-identity
+// operations. LoadToken returns a token identifying the current store of a
+// key, which the other operations compare against.
+type pointerMapInterface interface {
+	Store(key, value any)
+	Delete(any)
+	LoadToken(key any) (token, value any, ok bool)
+	CompareAndSwapToken(key, token, new any) (swapped bool)
+	CompareAndDeleteToken(key, token any) (deleted bool)
+	Range(func(key, value any) (shouldContinue bool))
+}
+
+// pointerMap implements pointerMapInterface with the pointer-identity
+// operations of Map.
+type pointerMap struct {
+	sync_map.Map[any, any]
+}
+
+func (m *pointerMap) LoadToken(key any) (token, value any, ok bool) {
+	p, ok := m.LoadPointer(key)
+	if !ok {
+		return nil, nil, false
+	}
+	return p, *p, true
+}
+
+func (m *pointerMap) CompareAndSwapToken(key, token, new any) (swapped bool) {
+	p, _ := token.(*any)
+	return m.CompareAndSwapPointer(key, p, new)
+}
+
+func (m *pointerMap) CompareAndDeleteToken(key, token any) (deleted bool) {
+	p, _ := token.(*any)
+	return m.CompareAndDeletePointer(key, p)
+}
+
+// generationMap implements pointerMapInterface with an RWMutexMap, using a
+// counter of the stores to each key as the token.
+type generationMap struct {
+	RWMutexMap
+	gen  map[any]int
+	next int
+}
+
+func (m *generationMap) bump(key any) {
+	if m.gen == nil {
+		m.gen = make(map[any]int)
+	}
+	m.next++
+	m.gen[key] = m.next
+}
+
+func (m *generationMap) Store(key, value any) {
+	m.RWMutexMap.Store(key, value)
+	m.bump(key)
+}
+
+func (m *generationMap) LoadToken(key any) (token, value any, ok bool) {
+	value, ok = m.Load(key)
+	if !ok {
+		return nil, nil, false
+	}
+	return m.gen[key], value, true
+}
+
+func (m *generationMap) CompareAndSwapToken(key, token, new any) (swapped bool) {
+	if _, ok := m.Load(key); !ok || token != any(m.gen[key]) {
+		return false
+	}
+	m.Store(key, new)
+	return true
+}
+
+func (m *generationMap) CompareAndDeleteToken(key, token any) (deleted bool) {
+	if _, ok := m.Load(key); !ok || token != any(m.gen[key]) {
+		return false
+	}
+	m.Delete(key)
+	return true
+}
+
+const (
+	opLoadToken             = mapOp("LoadToken")
+	opCompareAndSwapToken   = mapOp("CompareAndSwapToken")
+	opCompareAndDeleteToken = mapOp("CompareAndDeleteToken")
+)
+
+var pointerOps = [...]mapOp{
+	opStore,
+	opDelete,
+	opLoadToken,
+	opCompareAndSwapToken,
+	opCompareAndDeleteToken,
+}
+
+// pointerCall is a quick.Generator for calls on pointerMapInterface. Values
+// are drawn from a small set, so that a key is often stored again with an
+// equal value, which must still invalidate its earlier tokens.
+type pointerCall struct {
+	op   mapOp
+	k, v any
+}
+
+func (pointerCall) Generate(r *rand.Rand, size int) reflect.Value {
+	c := pointerCall{
+		op: pointerOps[r.Intn(len(pointerOps))],
+		k:  string(rune('a' + r.Intn(3))),
+		v:  r.Intn(2),
+	}
+	return reflect.ValueOf(c)
+}
+
+func applyPointerCalls(m pointerMapInterface, calls []pointerCall) (results []mapResult, final map[any]any) {
+	// tokens holds the token most recently loaded for each key.
+	tokens := make(map[any]any)
+	for _, c := range calls {
+		var r mapResult
+		switch c.op {
+		case opStore:
+			m.Store(c.k, c.v)
+		case opDelete:
+			m.Delete(c.k)
+		case opLoadToken:
+			var token any
+			token, r.value, r.ok = m.LoadToken(c.k)
+			if r.ok {
+				tokens[c.k] = token
+			}
+		case opCompareAndSwapToken:
+			r.ok = m.CompareAndSwapToken(c.k, tokens[c.k], c.v)
+		case opCompareAndDeleteToken:
+			r.ok = m.CompareAndDeleteToken(c.k, tokens[c.k])
+		default:
+			panic("invalid mapOp")
+		}
+		results = append(results, r)
+	}
+
+	final = make(map[any]any)
+	m.Range(func(k, v any) bool {
+		final[k] = v
+		return true
+	})
+
+	return results, final
+}
+
+func TestCompareAndSwapPointerMatchesRWMutex(t *testing.T) {
+	applyMap := func(calls []pointerCall) ([]mapResult, map[any]any) {
+		return applyPointerCalls(new(pointerMap), calls)
+	}
+	applyGenerationMap := func(calls []pointerCall) ([]mapResult, map[any]any) {
+		return applyPointerCalls(new(generationMap), calls)
+	}
+	if err := quick.CheckEqual(applyMap, applyGenerationMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConcurrentCompareAndSwapPointer(t *testing.T) {
+	const goroutines, increments = 8, 1 << 10
+
+	// Increment a counter with optimistic concurrency: each increment must be
+	// applied exactly once.
+	var m sync_map.Map[string, int]
+	m.Store("n", 0)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				for {
+					p, _ := m.LoadPointer("n")
+					if m.CompareAndSwapPointer("n", p, *p+1) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := m.Load("n"); v != goroutines*increments {
+		t.Errorf("after %d increments, counter = %d", goroutines*increments, v)
+	}
+}
+
+func TestConcurrentCompute(t *testing.T) {
+	const keys, increments = 16, 1 << 10
+
+	var m sync_map.Map[int, int]
+	var wg sync.WaitGroup
+	for g := runtime.GOMAXPROCS(0); g > 0; g-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				m.Compute(i%keys, func(old int, loaded bool) (int, sync_map.ComputeOp) {
+					return old + 1, sync_map.UpdateOp
+				})
+			}
+		}()
+	}
+	// Deleting and re-adding other keys forces Compute through the slow path.
+	for i := 0; i < increments; i++ {
+		m.Store(keys+i, i)
+		m.Delete(keys + i)
+	}
+	wg.Wait()
+
+	want := runtime.GOMAXPROCS(0) * increments / keys
+	for k := 0; k < keys; k++ {
+		if v, _ := m.Load(k); v != want {
+			t.Errorf("after concurrent Compute, m[%v] = %v; want %v", k, v, want)
+		}
+	}
+}
+
+func TestLoadOrComputeCallsOnlyWhenMissing(t *testing.T) {
+	var m sync_map.Map[string, int]
+	calls := 0
+	value := func() int {
+		calls++
+		return 42
+	}
+
+	if v, loaded := m.LoadOrCompute("a", value); loaded || v != 42 {
+		t.Fatalf("LoadOrCompute on empty map = %v, %v; want 42, false", v, loaded)
+	}
+	if v, loaded := m.LoadOrCompute("a", value); !loaded || v != 42 {
+		t.Fatalf("LoadOrCompute on existing key = %v, %v; want 42, true", v, loaded)
+	}
+	if calls != 1 {
+		t.Fatalf("LoadOrCompute called value %v times; want 1", calls)
+	}
+}
+
 func TestConcurrentRange(t *testing.T) {
 	const mapSize = 1 << 10
 
@@ -253,3 +680,201 @@ func TestMapRangeNoAllocations(t *testing.T) { // Issue 62404
 		t.Errorf("AllocsPerRun of m.Range = %v; want 0", allocs)
 	}
 }
+
+func TestMapLen(t *testing.T) {
+	var m sync_map.Map[int, int]
+	check := func(want int) {
+		t.Helper()
+		if n := m.Len(); n != want {
+			t.Fatalf("Len() = %v; want %v", n, want)
+		}
+	}
+
+	check(0)
+	m.Store(1, 1)
+	m.Store(1, 2)
+	check(1)
+	m.LoadOrStore(2, 2)
+	m.LoadOrStore(2, 3)
+	check(2)
+	m.Swap(3, 3)
+	check(3)
+	m.Delete(1)
+	m.Delete(1)
+	check(2)
+	if !sync_map.CompareAndDelete(&m, 2, 2) {
+		t.Fatalf("CompareAndDelete(2, 2) failed")
+	}
+	check(1)
+	m.Compute(4, func(int, bool) (int, sync_map.ComputeOp) { return 4, sync_map.UpdateOp })
+	m.Compute(3, func(int, bool) (int, sync_map.ComputeOp) { return 0, sync_map.DeleteOp })
+	check(1)
+	m.LoadAndDelete(4)
+	check(0)
+
+	// Deleted entries are reused when their keys are stored again.
+	for i := 0; i < 8; i++ {
+		m.Store(i, i)
+		m.Load(i)
+	}
+	for i := 0; i < 8; i += 2 {
+		m.Delete(i)
+	}
+	for i := 0; i < 8; i++ {
+		m.Store(i, i)
+	}
+	check(8)
+}
+
+func TestConcurrentLen(t *testing.T) {
+	const keys = 1 << 10
+
+	var m sync_map.Map[int, int]
+	var wg sync.WaitGroup
+	procs := runtime.GOMAXPROCS(0)
+	for g := 0; g < procs; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				k := g*keys + i
+				m.Store(k, i)
+				if i%2 == 0 {
+					m.Delete(k)
+				}
+				m.LoadOrStore(i, i)
+				m.LoadAndDelete(i + keys/2)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	want := 0
+	m.Range(func(_, _ int) bool {
+		want++
+		return true
+	})
+	if n := m.Len(); n != want {
+		t.Fatalf("after concurrent operations, Len() = %v; Range visited %v entries", n, want)
+	}
+}
+
+func TestMapPromote(t *testing.T) {
+	var misses []int
+	m := sync_map.NewMap[int, int](sync_map.WithPromotionPolicy(
+		func(n, _, _ int) bool {
+			misses = append(misses, n)
+			return false
+		}))
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+	m.Promote()
+	for i := 0; i < 10; i++ {
+		if v, ok := m.Load(i); !ok || v != i {
+			t.Fatalf("Load(%v) = %v, %v; want %v, true", i, v, ok, i)
+		}
+	}
+	if len(misses) != 0 {
+		t.Errorf("loads after Promote missed the read map %v times; want 0", len(misses))
+	}
+}
+
+func TestMapCompactKeepsKeys(t *testing.T) {
+	var m sync_map.Map[int, int]
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+	m.Promote()
+	for i := 0; i < 100; i += 3 {
+		m.Delete(i)
+	}
+	// Leave some keys only in the dirty map.
+	for i := 100; i < 110; i++ {
+		m.Store(i, i)
+	}
+	want := map[int]int{}
+	m.Range(func(k, v int) bool {
+		want[k] = v
+		return true
+	})
+
+	m.Compact()
+
+	got := map[int]int{}
+	m.Range(func(k, v int) bool {
+		got[k] = v
+		return true
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after Compact, map contains %v; want %v", got, want)
+	}
+	if m.Len() != len(want) {
+		t.Errorf("after Compact, Len() = %v; want %v", m.Len(), len(want))
+	}
+
+	// Deleted keys can be stored again.
+	m.Store(0, 42)
+	if v, ok := m.Load(0); !ok || v != 42 {
+		t.Errorf("Load(0) after Compact and Store = %v, %v; want 42, true", v, ok)
+	}
+}
+
+func TestMapCompactReleasesMemory(t *testing.T) {
+	const n = 1 << 16
+
+	heapAlloc := func() int64 {
+		runtime.GC()
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		return int64(ms.HeapAlloc)
+	}
+
+	var m sync_map.Map[int, [16]int]
+	base := heapAlloc()
+	for i := 0; i < n; i++ {
+		m.Store(i, [16]int{i})
+	}
+	m.Promote()
+	for i := 1; i < n; i++ {
+		m.Delete(i)
+	}
+	before := heapAlloc()
+	m.Compact()
+	after := heapAlloc()
+
+	if _, ok := m.Load(0); !ok {
+		t.Fatalf("Compact dropped the only remaining key")
+	}
+	if grown := before - base; after-base > grown/4 {
+		t.Errorf("heap grew by %v bytes for %v deleted entries, and by %v bytes after Compact; want less than a quarter",
+			grown, n-1, after-base)
+	}
+	runtime.KeepAlive(&m)
+}
+
+func TestMapCompactReleasesKeys(t *testing.T) {
+	var m sync_map.Map[*int, struct{}]
+	var finalized uint32
+	for i := 0; i < 16; i++ {
+		p := new(int)
+		runtime.SetFinalizer(p, func(*int) {
+			atomic.AddUint32(&finalized, 1)
+		})
+		m.Store(p, struct{}{})
+	}
+	m.Promote()
+	m.Range(func(k *int, _ struct{}) bool {
+		m.Delete(k)
+		return true
+	})
+
+	m.Compact()
+	for i := 0; i < 100 && atomic.LoadUint32(&finalized) == 0; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	if atomic.LoadUint32(&finalized) == 0 {
+		t.Errorf("deleted keys were not collected after Compact")
+	}
+}
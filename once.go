@@ -0,0 +1,133 @@
+package sync_map
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// onceCalls holds the calls in progress in LoadOrComputeOnce. They are only
+// looked up after a miss, when the caller is about to call (or wait for) an
+// expensive function, so a mutex is cheap enough.
+type onceCalls[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*onceCall[V]
+}
+
+// A onceCall is a call to the function passed to LoadOrComputeOnce that
+// other callers for the same key can wait for.
+type onceCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// LoadOrComputeOnce returns the existing value for the key if present.
+// Otherwise, it calls f, stores the result if f succeeds, and returns it.
+//
+// Concurrent calls for the same missing key share a single call to f: one of
+// them calls f, and the others wait for it and return its result, including
+// its error. Errors are not stored, so the next call after a failure calls f
+// again. If the key is stored by other means while f runs, the stored value
+// is kept and returned instead of f's result.
+//
+// f is called without holding any lock, so it may call any method on m,
+// except LoadOrComputeOnce for the same key, which would deadlock. If f
+// panics, the panic propagates to its caller, wrapped in an error that holds
+// the stack trace of the panic, and the callers waiting for it return an
+// error.
+func (m *Map[K, V]) LoadOrComputeOnce(key K, f func() (V, error)) (V, error) {
+	if v, ok := m.Load(key); ok {
+		return v, nil
+	}
+
+	oc := m.onceCalls()
+	oc.mu.Lock()
+	if c, ok := oc.calls[key]; ok {
+		oc.mu.Unlock()
+		<-c.done
+		return c.value, c.err
+	}
+	c := &onceCall[V]{done: make(chan struct{})}
+	oc.calls[key] = c
+	oc.mu.Unlock()
+
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		r := recover()
+		if r == nil {
+			// f called runtime.Goexit.
+			c.err = errors.New("sync_map: LoadOrComputeOnce function exited without returning")
+			oc.finish(key, c)
+			return
+		}
+		c.err = fmt.Errorf("sync_map: LoadOrComputeOnce function panicked: %v", r)
+		oc.finish(key, c)
+		// The deferred call runs on top of the stack of the panic, so record
+		// it before it is unwound.
+		panic(newPanicError(r))
+	}()
+
+	// The previous call for key may have stored its result after this call's
+	// first Load.
+	if v, ok := m.Load(key); ok {
+		c.value = v
+	} else if c.value, c.err = f(); c.err == nil {
+		c.value, _ = m.LoadOrStore(key, c.value)
+	}
+	completed = true
+
+	oc.finish(key, c)
+	return c.value, c.err
+}
+
+// A panicError is a value recovered from a panic in the function passed to
+// LoadOrComputeOnce, with the stack trace of the panic, since re-raising the
+// value would lose it.
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (p *panicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+func (p *panicError) Unwrap() error {
+	err, _ := p.value.(error)
+	return err
+}
+
+func newPanicError(v any) error {
+	stack := debug.Stack()
+	// Trim the first line, "goroutine N [running]:", which the runtime
+	// prints again if the panic crashes the program.
+	if line := bytes.IndexByte(stack, '\n'); line >= 0 {
+		stack = stack[line+1:]
+	}
+	return &panicError{value: v, stack: stack}
+}
+
+// finish removes the finished call c for key and wakes its waiters. Later
+// callers load the stored value, or call f again after an error.
+func (oc *onceCalls[K, V]) finish(key K, c *onceCall[V]) {
+	oc.mu.Lock()
+	delete(oc.calls, key)
+	oc.mu.Unlock()
+	close(c.done)
+}
+
+// onceCalls returns the calls in progress in LoadOrComputeOnce, creating the
+// set of calls if needed.
+func (m *Map[K, V]) onceCalls() *onceCalls[K, V] {
+	if oc := m.once.Load(); oc != nil {
+		return oc
+	}
+	m.once.CompareAndSwap(nil, &onceCalls[K, V]{calls: make(map[K]*onceCall[V])})
+	return m.once.Load()
+}
@@ -0,0 +1,155 @@
+package sync_map_test
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+func TestMapLoadOrComputeOnce(t *testing.T) {
+	var m sync_map.Map[string, int]
+	m.Store("present", 1)
+	v, err := m.LoadOrComputeOnce("present", func() (int, error) {
+		t.Errorf("f called for present key")
+		return 0, nil
+	})
+	if v != 1 || err != nil {
+		t.Errorf("LoadOrComputeOnce of present key = %v, %v; want 1, nil", v, err)
+	}
+
+	v, err = m.LoadOrComputeOnce("missing", func() (int, error) { return 2, nil })
+	if v != 2 || err != nil {
+		t.Errorf("LoadOrComputeOnce of missing key = %v, %v; want 2, nil", v, err)
+	}
+	if v, ok := m.Load("missing"); !ok || v != 2 {
+		t.Errorf("Load after LoadOrComputeOnce = %v, %v; want 2, true", v, ok)
+	}
+}
+
+func TestMapLoadOrComputeOnceContention(t *testing.T) {
+	var m sync_map.Map[int, int]
+	const keys = 8
+	callers := 16 * runtime.GOMAXPROCS(0)
+
+	var calls [keys]atomic.Int32
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		for k := 0; k < keys; k++ {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				<-start
+				v, err := m.LoadOrComputeOnce(k, func() (int, error) {
+					calls[k].Add(1)
+					runtime.Gosched()
+					return k * 10, nil
+				})
+				if v != k*10 || err != nil {
+					t.Errorf("LoadOrComputeOnce(%d) = %v, %v; want %d, nil", k, v, err, k*10)
+				}
+			}(k)
+		}
+	}
+	close(start)
+	wg.Wait()
+
+	for k := range calls {
+		if n := calls[k].Load(); n != 1 {
+			t.Errorf("f called %d times for key %d; want 1", n, k)
+		}
+	}
+}
+
+func TestMapLoadOrComputeOnceErrors(t *testing.T) {
+	var m sync_map.Map[string, int]
+	errFailed := errors.New("failed")
+
+	// Every caller waiting for a failed call shares its error.
+	const callers = 8
+	release := make(chan struct{})
+	var calls atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.LoadOrComputeOnce("k", func() (int, error) {
+				calls.Add(1)
+				<-release
+				return 0, errFailed
+			})
+			if err != errFailed {
+				t.Errorf("LoadOrComputeOnce with failing f: err = %v; want %v", err, errFailed)
+			}
+		}()
+	}
+	waitFor(t, "f to be called", func() bool { return calls.Load() == 1 })
+	close(release)
+	wg.Wait()
+	if _, ok := m.Load("k"); ok {
+		t.Errorf("LoadOrComputeOnce stored the result of a failed call")
+	}
+
+	// The error is not cached.
+	calls.Store(0)
+	v, err := m.LoadOrComputeOnce("k", func() (int, error) {
+		calls.Add(1)
+		return 3, nil
+	})
+	if v != 3 || err != nil || calls.Load() != 1 {
+		t.Errorf("LoadOrComputeOnce after failure = %v, %v with %d calls; want 3, nil with 1 call", v, err, calls.Load())
+	}
+}
+
+func TestMapLoadOrComputeOncePanic(t *testing.T) {
+	var m sync_map.Map[string, int]
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	waiterErr := make(chan error)
+	go func() {
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Errorf("panic in f did not propagate to its caller")
+				return
+			}
+			// The panic carries the stack of f, not only of the re-panic.
+			if s := fmt.Sprint(r); !strings.Contains(s, "boom") || !strings.Contains(s, "once_test.go") {
+				t.Errorf("panic in f propagated as %q; want its value and stack", s)
+			}
+		}()
+		m.LoadOrComputeOnce("k", func() (int, error) {
+			close(entered)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-entered
+	go func() {
+		_, err := m.LoadOrComputeOnce("k", func() (int, error) { return 1, nil })
+		waiterErr <- err
+	}()
+	// The waiter may arrive after the panic, in which case it calls f itself.
+	close(release)
+	if err := <-waiterErr; err != nil {
+		if v, ok := m.Load("k"); ok {
+			t.Errorf("after panic, key was stored with %v", v)
+		}
+	}
+
+	v, err := m.LoadOrComputeOnce("k", func() (int, error) { return 2, nil })
+	if err != nil {
+		t.Errorf("LoadOrComputeOnce after panic: err = %v; want nil", err)
+	}
+	if v != 1 && v != 2 {
+		t.Errorf("LoadOrComputeOnce after panic = %v; want 1 or 2", v)
+	}
+}
@@ -0,0 +1,96 @@
+package sync_map
+
+// An Option configures a Map created by [NewMap].
+type Option func(*options)
+
+type options struct {
+	promote PromotionPolicy
+	stats   bool
+	hooks   any // *Hooks[K, V], checked by configure
+}
+
+// NewMap returns an empty Map configured by opts.
+//
+// A Map created by NewMap with no options behaves exactly like the zero Map.
+func NewMap[K comparable, V any](opts ...Option) *Map[K, V] {
+	m := new(Map[K, V])
+	m.configure(opts)
+	return m
+}
+
+// FromMap returns a Map configured by opts holding the entries of src.
+//
+// Unlike storing the entries in an empty Map, FromMap builds the read map
+// directly, so that loads of the entries take the fast path immediately
+// instead of missing until the dirty map is promoted. The Map's hooks are not
+// called for the entries of src.
+func FromMap[K comparable, V any](src map[K]V, opts ...Option) *Map[K, V] {
+	read := make(map[K]*entry[V], len(src))
+	for k, v := range src {
+		read[k] = newEntry(v)
+	}
+	return newLoadedMap(read, opts)
+}
+
+// newLoadedMap returns a Map configured by opts whose read map is read.
+func newLoadedMap[K comparable, V any](read map[K]*entry[V], opts []Option) *Map[K, V] {
+	m := NewMap[K, V](opts...)
+	m.read.Store(&readOnly[K, V]{m: read})
+	m.count.Store(int64(len(read)))
+	return m
+}
+
+// configure applies opts to a Map that has not been used yet.
+func (m *Map[K, V]) configure(opts []Option) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	m.promote = o.promote
+	if o.stats {
+		m.stats = new(mapCounters)
+	}
+	m.configureHooks(o.hooks)
+}
+
+// A PromotionPolicy decides when a Map promotes its dirty map to its read map.
+//
+// Each load (or other operation) that has to lock the Map to find a key records
+// a miss. After each miss, the Map calls its PromotionPolicy with the number of
+// misses since the last promotion and the sizes of the dirty and read maps; if
+// the policy returns true, the dirty map is promoted and the miss count is
+// reset.
+//
+// Promoting sooner means fewer loads take the slow path, but more stores have
+// to copy the read map to create a new dirty map. The policy is called with
+// the Map's lock held, so it must be fast and must not call methods on the Map.
+type PromotionPolicy func(misses, dirtyLen, readLen int) bool
+
+// WithPromotionPolicy sets the policy that decides when the Map promotes its
+// dirty map. The default is PromoteByRatio(1).
+func WithPromotionPolicy(p PromotionPolicy) Option {
+	return func(o *options) {
+		o.promote = p
+	}
+}
+
+// PromoteByRatio returns a PromotionPolicy that promotes the dirty map once
+// the number of misses reaches multiplier times the size of the dirty map.
+//
+// PromoteByRatio(1) is the default policy: it promotes once the misses have
+// covered the cost of copying the dirty map. Larger multipliers delay
+// promotion for maps whose dirty keys are rarely loaded; smaller multipliers
+// promote sooner.
+func PromoteByRatio(multiplier float64) PromotionPolicy {
+	return func(misses, dirtyLen, _ int) bool {
+		return float64(misses) >= multiplier*float64(dirtyLen)
+	}
+}
+
+// PromoteAfterMisses returns a PromotionPolicy that promotes the dirty map
+// after a fixed number of misses, regardless of the size of the map.
+func PromoteAfterMisses(n int) PromotionPolicy {
+	return func(misses, _, _ int) bool {
+		return misses >= n
+	}
+}
@@ -0,0 +1,102 @@
+package sync_map_test
+
+import (
+	"reflect"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+func TestPromotionPolicies(t *testing.T) {
+	tests := []struct {
+		name                      string
+		policy                    sync_map.PromotionPolicy
+		misses, dirtyLen, readLen int
+		want                      bool
+	}{
+		{"ratio below", sync_map.PromoteByRatio(1), 9, 10, 0, false},
+		{"ratio reached", sync_map.PromoteByRatio(1), 10, 10, 0, true},
+		{"large ratio", sync_map.PromoteByRatio(4), 39, 10, 0, false},
+		{"small ratio", sync_map.PromoteByRatio(0.1), 1, 10, 0, true},
+		{"misses below", sync_map.PromoteAfterMisses(100), 99, 1, 0, false},
+		{"misses reached", sync_map.PromoteAfterMisses(100), 100, 1 << 20, 0, true},
+	}
+	for _, tt := range tests {
+		if got := tt.policy(tt.misses, tt.dirtyLen, tt.readLen); got != tt.want {
+			t.Errorf("%s: policy(%v, %v, %v) = %v; want %v",
+				tt.name, tt.misses, tt.dirtyLen, tt.readLen, got, tt.want)
+		}
+	}
+}
+
+// promotionMisses returns the miss counts with which a Map using policy
+// consults it while loading one of 10 dirty keys 12 times.
+func promotionMisses(policy sync_map.PromotionPolicy) []int {
+	var calls []int
+	m := sync_map.NewMap[int, int](sync_map.WithPromotionPolicy(
+		func(misses, dirtyLen, readLen int) bool {
+			calls = append(calls, misses)
+			return policy(misses, dirtyLen, readLen)
+		}))
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+	for i := 0; i < 12; i++ {
+		m.Load(0)
+	}
+	return calls
+}
+
+func TestMapPromotionPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy sync_map.PromotionPolicy
+		want   []int
+	}{
+		// After the dirty map is promoted, loads of key 0 take the fast path
+		// and no longer consult the policy.
+		{"default", sync_map.PromoteByRatio(1), []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"half ratio", sync_map.PromoteByRatio(0.5), []int{1, 2, 3, 4, 5}},
+		{"after 3 misses", sync_map.PromoteAfterMisses(3), []int{1, 2, 3}},
+		{"never", func(int, int, int) bool { return false }, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}},
+	}
+	for _, tt := range tests {
+		if got := promotionMisses(tt.policy); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: policy called with misses %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewMapDefaults(t *testing.T) {
+	m := sync_map.NewMap[string, int]()
+	m.Store("a", 1)
+	if v, ok := m.Load("a"); !ok || v != 1 {
+		t.Fatalf("Load(%q) = %v, %v; want 1, true", "a", v, ok)
+	}
+}
+
+func TestFromMap(t *testing.T) {
+	src := map[string]int{"a": 1, "b": 2, "c": 3}
+	m := sync_map.FromMap(src, sync_map.WithStats())
+	for k, want := range src {
+		if v, ok := m.Load(k); !ok || v != want {
+			t.Errorf("Load(%q) = %v, %v; want %v, true", k, v, ok, want)
+		}
+	}
+	if _, ok := m.Load("d"); ok {
+		t.Errorf("Load of missing key found a value")
+	}
+	// The entries are in the read map, so no load locked the map.
+	if s := m.Stats(); s.Len != len(src) || s.ReadLen != len(src) || s.Amended || s.SlowPaths.Load != 0 {
+		t.Errorf("Stats() = %+v; want Len and ReadLen %v, no dirty keys and no slow loads", s, len(src))
+	}
+
+	m.Store("d", 4)
+	m.Delete("a")
+	if want := map[string]int{"b": 2, "c": 3, "d": 4}; !reflect.DeepEqual(mapContents(m), want) {
+		t.Errorf("after Store and Delete, map holds %v; want %v", mapContents(m), want)
+	}
+	if src["a"] != 1 {
+		t.Errorf("modifying the Map modified its source")
+	}
+}
@@ -0,0 +1,105 @@
+package sync_map
+
+// Set is a set of values of type K that is safe for concurrent use by multiple
+// goroutines without additional locking or coordination.
+//
+// Set is a [Map] from K to struct{}, and has the same performance
+// characteristics. Because struct{} values have no size, storing them needs
+// no allocation, so adding a key that was previously removed from the read map
+// does not allocate at all.
+//
+// The zero Set is empty and ready for use. A Set must not be copied after
+// first use.
+type Set[K comparable] struct {
+	m Map[K, struct{}]
+}
+
+// Add adds key to the set.
+func (s *Set[K]) Add(key K) {
+	s.AddIfAbsent(key)
+}
+
+// AddIfAbsent adds key to the set if it is not already present.
+// The added result reports whether key was added.
+func (s *Set[K]) AddIfAbsent(key K) (added bool) {
+	// LoadOrStore rather than Store, so that adding a key that is already
+	// present does not write to its entry.
+	_, loaded := s.m.LoadOrStore(key, struct{}{})
+	return !loaded
+}
+
+// Remove removes key from the set.
+// The removed result reports whether key was present.
+func (s *Set[K]) Remove(key K) (removed bool) {
+	_, removed = s.m.LoadAndDelete(key)
+	return removed
+}
+
+// Contains reports whether key is in the set.
+func (s *Set[K]) Contains(key K) bool {
+	_, ok := s.m.Load(key)
+	return ok
+}
+
+// Len returns the number of keys in the set. See [Map.Len].
+func (s *Set[K]) Len() int {
+	return s.m.Len()
+}
+
+// Range calls f sequentially for each key present in the set.
+// If f returns false, range stops the iteration.
+//
+// Range has the same semantics as [Map.Range].
+func (s *Set[K]) Range(f func(key K) bool) {
+	s.m.Range(func(key K, _ struct{}) bool {
+		return f(key)
+	})
+}
+
+// Union returns a new set holding the keys that are in s, other, or both.
+//
+// Like Range, Union does not correspond to a consistent snapshot of either set
+// if they are modified concurrently.
+func (s *Set[K]) Union(other *Set[K]) *Set[K] {
+	result := new(Set[K])
+	s.Range(func(key K) bool {
+		result.Add(key)
+		return true
+	})
+	other.Range(func(key K) bool {
+		result.Add(key)
+		return true
+	})
+	return result
+}
+
+// Intersect returns a new set holding the keys that are in both s and other.
+//
+// Like Range, Intersect does not correspond to a consistent snapshot of either
+// set if they are modified concurrently.
+func (s *Set[K]) Intersect(other *Set[K]) *Set[K] {
+	result := new(Set[K])
+	s.Range(func(key K) bool {
+		if other.Contains(key) {
+			result.Add(key)
+		}
+		return true
+	})
+	return result
+}
+
+// Difference returns a new set holding the keys that are in s but not in
+// other.
+//
+// Like Range, Difference does not correspond to a consistent snapshot of
+// either set if they are modified concurrently.
+func (s *Set[K]) Difference(other *Set[K]) *Set[K] {
+	result := new(Set[K])
+	s.Range(func(key K) bool {
+		if !other.Contains(key) {
+			result.Add(key)
+		}
+		return true
+	})
+	return result
+}
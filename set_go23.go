@@ -0,0 +1,17 @@
+//go:build go1.23
+
+package sync_map
+
+import "iter"
+
+// All returns an iterator over each key present in the set.
+//
+// The iterator has the same semantics as [Map.Range].
+func (s *Set[K]) All() iter.Seq[K] {
+	return s.m.Keys()
+}
+
+// Clear removes all the keys, resulting in an empty Set.
+func (s *Set[K]) Clear() {
+	s.m.Clear()
+}
@@ -0,0 +1,126 @@
+package sync_map_test
+
+import (
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+func setKeys(s *sync_map.Set[int]) []int {
+	keys := []int{}
+	s.Range(func(k int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Ints(keys)
+	return keys
+}
+
+func newSet(keys ...int) *sync_map.Set[int] {
+	s := new(sync_map.Set[int])
+	for _, k := range keys {
+		s.Add(k)
+	}
+	return s
+}
+
+func TestSet(t *testing.T) {
+	var s sync_map.Set[int]
+	if !s.AddIfAbsent(1) {
+		t.Fatalf("AddIfAbsent(1) on empty set = false; want true")
+	}
+	if s.AddIfAbsent(1) {
+		t.Fatalf("AddIfAbsent(1) on set containing 1 = true; want false")
+	}
+	s.Add(2)
+	s.Add(2)
+	if !s.Contains(1) || !s.Contains(2) || s.Contains(3) {
+		t.Fatalf("set contains %v; want [1 2]", setKeys(&s))
+	}
+	if s.Len() != 2 {
+		t.Fatalf("Len() = %v; want 2", s.Len())
+	}
+	if !s.Remove(1) {
+		t.Fatalf("Remove(1) = false; want true")
+	}
+	if s.Remove(1) {
+		t.Fatalf("Remove(1) of removed key = true; want false")
+	}
+	if got := setKeys(&s); !reflect.DeepEqual(got, []int{2}) {
+		t.Fatalf("set contains %v; want [2]", got)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	a := newSet(1, 2, 3, 4)
+	b := newSet(3, 4, 5)
+
+	tests := []struct {
+		name string
+		got  *sync_map.Set[int]
+		want []int
+	}{
+		{"Union", a.Union(b), []int{1, 2, 3, 4, 5}},
+		{"Intersect", a.Intersect(b), []int{3, 4}},
+		{"Difference", a.Difference(b), []int{1, 2}},
+		{"reverse Difference", b.Difference(a), []int{5}},
+		{"Intersect empty", a.Intersect(newSet()), []int{}},
+	}
+	for _, tt := range tests {
+		if got := setKeys(tt.got); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+	if got := setKeys(a); !reflect.DeepEqual(got, []int{1, 2, 3, 4}) {
+		t.Errorf("set algebra modified its receiver: %v", got)
+	}
+}
+
+func TestSetNoAllocations(t *testing.T) {
+	s := newSet(1)
+	// Make the key reachable without locking.
+	s.Range(func(int) bool { return true })
+
+	allocs := testing.AllocsPerRun(100, func() {
+		s.Add(1)
+		s.Contains(1)
+		s.Remove(1)
+		s.AddIfAbsent(1)
+	})
+	if allocs > 0 {
+		t.Errorf("AllocsPerRun of Set operations on an existing key = %v; want 0", allocs)
+	}
+}
+
+func TestConcurrentSetAddIfAbsent(t *testing.T) {
+	const keys = 1 << 10
+
+	var s sync_map.Set[int]
+	var added [keys]int32
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for g := runtime.GOMAXPROCS(0); g > 0; g-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				if s.AddIfAbsent(i) {
+					mu.Lock()
+					added[i]++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, n := range added {
+		if n != 1 {
+			t.Fatalf("AddIfAbsent(%v) reported adding the key %v times; want 1", i, n)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package sync_map
+
+import (
+	"runtime"
+)
+
+// cacheLinePadSize is the assumed size of a CPU cache line, used to keep
+// shards of a ShardedMap from sharing cache lines.
+const cacheLinePadSize = 64
+
+// ShardedMap is like a [Map], but partitions its keys across several
+// independent Maps (shards) by hash.
+//
+// Each shard has its own lock and its own dirty map, so operations that add
+// new keys contend only with other operations on the same shard, and
+// promoting a shard's dirty map copies only that shard. This makes ShardedMap
+// a better fit than Map for workloads that store many unique keys, at the cost
+// of hashing every key.
+//
+// The zero ShardedMap is not usable; create one with [NewShardedMap].
+// A ShardedMap must not be copied after first use.
+type ShardedMap[K comparable, V any] struct {
+	shards []shard[K, V]
+	hash   func(K) uint64
+	mask   uint64
+}
+
+type shard[K comparable, V any] struct {
+	Map[K, V]
+	_ [cacheLinePadSize]byte
+}
+
+// ShardStats describes the state of one shard of a [ShardedMap].
+type ShardStats struct {
+	// Stats describes the shard's Map. Its Len field is the number of entries
+	// in the shard.
+	Stats
+}
+
+// NewShardedMap returns an empty ShardedMap with the given number of shards,
+// rounded up to a power of two. If shards <= 0, the number of shards is
+// derived from GOMAXPROCS.
+//
+// hash is used to choose the shard for each key. If hash is nil, keys are
+// hashed with [hash/maphash.Comparable] when built with Go 1.24 or later;
+// earlier versions of Go have no way to hash an arbitrary comparable value, so
+// NewShardedMap panics if hash is nil.
+//
+// Each shard is configured by opts, as if created by [NewMap].
+func NewShardedMap[K comparable, V any](shards int, hash func(K) uint64, opts ...Option) *ShardedMap[K, V] {
+	if shards <= 0 {
+		shards = 4 * runtime.GOMAXPROCS(0)
+	}
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	if hash == nil {
+		hash = defaultHash[K]()
+		if hash == nil {
+			panic("sync_map: NewShardedMap requires a hash function before Go 1.24")
+		}
+	}
+	s := &ShardedMap[K, V]{
+		shards: make([]shard[K, V], n),
+		hash:   hash,
+		mask:   uint64(n - 1),
+	}
+	for i := range s.shards {
+		s.shards[i].configure(opts)
+	}
+	return s
+}
+
+// Shard returns the Map that holds key.
+//
+// Shard can be used to call functions that take a *Map, such as
+// [CompareAndSwap], on a ShardedMap.
+func (s *ShardedMap[K, V]) Shard(key K) *Map[K, V] {
+	return &s.shards[s.hash(key)&s.mask].Map
+}
+
+// Load returns the value stored in the map for a key, or the zero value if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (s *ShardedMap[K, V]) Load(key K) (value V, ok bool) {
+	return s.Shard(key).Load(key)
+}
+
+// Store sets the value for a key.
+func (s *ShardedMap[K, V]) Store(key K, value V) {
+	s.Shard(key).Store(key, value)
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (s *ShardedMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	return s.Shard(key).LoadOrStore(key, value)
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if any.
+// The loaded result reports whether the key was present.
+func (s *ShardedMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	return s.Shard(key).LoadAndDelete(key)
+}
+
+// Delete deletes the value for a key.
+func (s *ShardedMap[K, V]) Delete(key K) {
+	s.Shard(key).Delete(key)
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (s *ShardedMap[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	return s.Shard(key).Swap(key, value)
+}
+
+// Compute atomically computes the value for a key from its current value.
+// See [Map.Compute].
+func (s *ShardedMap[K, V]) Compute(key K, f func(old V, loaded bool) (new V, op ComputeOp)) (actual V, ok bool) {
+	return s.Shard(key).Compute(key, f)
+}
+
+// LoadOrCompute returns the existing value for the key if present.
+// Otherwise, it calls value, stores the result and returns it.
+// See [Map.LoadOrCompute].
+func (s *ShardedMap[K, V]) LoadOrCompute(key K, value func() V) (actual V, loaded bool) {
+	return s.Shard(key).LoadOrCompute(key, value)
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// Range visits the shards one after another, with the same semantics as
+// [Map.Range] within each shard. In particular, Range does not correspond to
+// any consistent snapshot of the ShardedMap's contents.
+func (s *ShardedMap[K, V]) Range(f func(key K, value V) bool) {
+	stopped := false
+	for i := range s.shards {
+		s.shards[i].Range(func(key K, value V) bool {
+			stopped = !f(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// Len returns the number of entries in the map.
+//
+// Len sums [Map.Len] over the shards, so operations that are concurrent with
+// Len may or may not be reflected in its result.
+func (s *ShardedMap[K, V]) Len() int {
+	n := 0
+	for i := range s.shards {
+		n += s.shards[i].Len()
+	}
+	return n
+}
+
+// ShardStats returns the state of each shard, in shard order.
+//
+// ShardStats calls [Map.Stats] on each shard in turn; see its documentation
+// for the cost.
+func (s *ShardedMap[K, V]) ShardStats() []ShardStats {
+	stats := make([]ShardStats, len(s.shards))
+	for i := range s.shards {
+		stats[i] = ShardStats{Stats: s.shards[i].Stats()}
+	}
+	return stats
+}
+
+// ShardedCompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+// The old value must be of a comparable type.
+//
+// It is the [ShardedMap] counterpart of [CompareAndSwap].
+func ShardedCompareAndSwap[K comparable, V comparable](s *ShardedMap[K, V], key K, old, new V) (swapped bool) {
+	return CompareAndSwap(s.Shard(key), key, old, new)
+}
+
+// ShardedCompareAndDelete deletes the entry for key if its value is equal to old.
+// The old value must be of a comparable type.
+//
+// It is the [ShardedMap] counterpart of [CompareAndDelete].
+func ShardedCompareAndDelete[K comparable, V comparable](s *ShardedMap[K, V], key K, old V) (deleted bool) {
+	return CompareAndDelete(s.Shard(key), key, old)
+}
@@ -0,0 +1,9 @@
+//go:build !go1.24
+
+package sync_map
+
+// defaultHash returns nil: maphash.Comparable is not available before Go 1.24,
+// so callers must provide their own hash function.
+func defaultHash[K comparable]() func(K) uint64 {
+	return nil
+}
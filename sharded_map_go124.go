@@ -0,0 +1,14 @@
+//go:build go1.24
+
+package sync_map
+
+import "hash/maphash"
+
+// defaultHash returns a function that hashes keys with maphash.Comparable
+// under a random seed.
+func defaultHash[K comparable]() func(K) uint64 {
+	seed := maphash.MakeSeed()
+	return func(key K) uint64 {
+		return maphash.Comparable(seed, key)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build go1.23
+
+package sync_map
+
+import "iter"
+
+// Clear deletes all the entries, resulting in an empty ShardedMap.
+//
+// Clear clears the shards one after another, so entries stored concurrently
+// with Clear may survive it.
+func (s *ShardedMap[K, V]) Clear() {
+	for i := range s.shards {
+		s.shards[i].Clear()
+	}
+}
+
+// All returns an iterator over each key and value present in the map.
+//
+// The iterator has the same semantics as [ShardedMap.Range].
+func (s *ShardedMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		s.Range(yield)
+	}
+}
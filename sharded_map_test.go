@@ -0,0 +1,134 @@
+package sync_map_test
+
+import (
+	"hash/maphash"
+	"runtime"
+	"sync"
+	"testing"
+	"testing/quick"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+var (
+	_ casMapInterface    = &CasShardedMap[any, any]{}
+	_ casMapInterfaceInt = &CasShardedMap[int, int]{}
+)
+
+func init() {
+	benchMaps = append(benchMaps,
+		benchImpl{"ShardedMap[any,any]", func() casMapInterface { return newCasShardedMap[any, any](hashAny) }})
+	benchMapsInt = append(benchMapsInt,
+		benchImplInt{"ShardedMap[int,int]", func() casMapInterfaceInt { return newCasShardedMap[int, int](hashInt) }})
+}
+
+var testSeed = maphash.MakeSeed()
+
+// hashAny hashes the string and int keys used by the tests and benchmarks.
+func hashAny(key any) uint64 {
+	switch key := key.(type) {
+	case string:
+		return maphash.String(testSeed, key)
+	case int:
+		return hashInt(key)
+	default:
+		panic("hashAny: unsupported key type")
+	}
+}
+
+func hashInt(key int) uint64 {
+	return uint64(key) * 0x9e3779b97f4a7c15
+}
+
+type CasShardedMap[K comparable, V comparable] struct {
+	*sync_map.ShardedMap[K, V]
+}
+
+func newCasShardedMap[K comparable, V comparable](hash func(K) uint64) *CasShardedMap[K, V] {
+	return &CasShardedMap[K, V]{sync_map.NewShardedMap[K, V](0, hash)}
+}
+
+func (c *CasShardedMap[K, V]) CompareAndSwap(key K, old, new V) (swapped bool) {
+	return sync_map.ShardedCompareAndSwap(c.ShardedMap, key, old, new)
+}
+
+func (c *CasShardedMap[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
+	return sync_map.ShardedCompareAndDelete(c.ShardedMap, key, old)
+}
+
+func applyShardedMap(calls []mapCall) ([]mapResult, map[any]any) {
+	return applyCalls(newCasShardedMap[any, any](hashAny), calls)
+}
+
+func TestShardedMapMatchesRWMutex(t *testing.T) {
+	if err := quick.CheckEqual(applyShardedMap, applyRWMutexMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShardedMapShards(t *testing.T) {
+	m := sync_map.NewShardedMap[int, int](5, hashInt)
+	const n = 1 << 10
+	for i := 0; i < n; i++ {
+		m.Store(i, i)
+	}
+
+	stats := m.ShardStats()
+	if len(stats) != 8 {
+		t.Fatalf("NewShardedMap(5) has %v shards; want 8", len(stats))
+	}
+	total := 0
+	for i, s := range stats {
+		if s.Len == 0 {
+			t.Errorf("shard %v is empty after storing %v keys", i, n)
+		}
+		total += s.Len
+	}
+	if total != n || m.Len() != n {
+		t.Errorf("shards hold %v entries and Len() = %v; want %v", total, m.Len(), n)
+	}
+
+	for i := 0; i < n; i++ {
+		if v, ok := m.Shard(i).Load(i); !ok || v != i {
+			t.Fatalf("Shard(%v).Load(%v) = %v, %v; want %v, true", i, i, v, ok, i)
+		}
+	}
+}
+
+func TestShardedMapRangeStops(t *testing.T) {
+	m := sync_map.NewShardedMap[int, int](4, hashInt)
+	for i := 0; i < 64; i++ {
+		m.Store(i, i)
+	}
+	visited := 0
+	m.Range(func(_, _ int) bool {
+		visited++
+		return visited < 3
+	})
+	if visited != 3 {
+		t.Errorf("Range visited %v entries after f returned false; want 3", visited)
+	}
+}
+
+func TestConcurrentShardedMapLoadOrStore(t *testing.T) {
+	const keys = 1 << 10
+
+	m := sync_map.NewShardedMap[int, int](0, hashInt)
+	var wg sync.WaitGroup
+	procs := runtime.GOMAXPROCS(0)
+	for g := 0; g < procs; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				m.LoadOrStore(g*keys+i, i)
+				m.LoadOrStore(i, g)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if want := procs * keys; m.Len() != want && procs > 1 {
+		t.Errorf("after concurrent LoadOrStore, Len() = %v; want %v", m.Len(), want)
+	}
+}
@@ -0,0 +1,215 @@
+package sync_map
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// A snapshot written by WriteSnapshot is laid out as follows, where uvarint is
+// an unsigned varint as written by encoding/binary:
+//
+//	magic    "SMAP"
+//	version  1 byte, snapshotVersion
+//	records  for each entry: snapshotEntry, uvarint length, payload
+//	end      snapshotEnd, uvarint number of entries
+//	checksum 4 bytes, big-endian CRC-32 (IEEE) of everything before it
+const (
+	snapshotMagic   = "SMAP"
+	snapshotVersion = 1
+
+	snapshotEnd   = 0
+	snapshotEntry = 1
+)
+
+// ErrCorruptSnapshot is returned by [Map.LoadSnapshot] when its input is not
+// a complete, well-formed snapshot.
+var ErrCorruptSnapshot = errors.New("sync_map: corrupt snapshot")
+
+// WriteSnapshot writes the entries of the map to w in a self-checking binary
+// format that [Map.LoadSnapshot] can read. Each entry is encoded by enc; the
+// format adds framing, a version and a trailing checksum, so that a truncated
+// or corrupted snapshot is detected when it is loaded.
+//
+// The entries are visited with [Map.Range] and written as they are visited,
+// so WriteSnapshot does not copy the map, and the snapshot does not
+// necessarily correspond to any consistent snapshot of the Map's contents if
+// it is modified concurrently. Like the callback of Range, enc may call any
+// method on m.
+func (m *Map[K, V]) WriteSnapshot(w io.Writer, enc func(K, V) ([]byte, error)) error {
+	bw := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	sw := io.MultiWriter(bw, crc)
+
+	var hdr [len(snapshotMagic) + 1]byte
+	copy(hdr[:], snapshotMagic)
+	hdr[len(snapshotMagic)] = snapshotVersion
+	if _, err := sw.Write(hdr[:]); err != nil {
+		return err
+	}
+
+	var err error
+	var n uint64
+	var scratch [1 + binary.MaxVarintLen64]byte
+	m.Range(func(key K, value V) bool {
+		var payload []byte
+		if payload, err = enc(key, value); err != nil {
+			return false
+		}
+		scratch[0] = snapshotEntry
+		l := binary.PutUvarint(scratch[1:], uint64(len(payload)))
+		if _, err = sw.Write(scratch[:1+l]); err != nil {
+			return false
+		}
+		if _, err = sw.Write(payload); err != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	scratch[0] = snapshotEnd
+	l := binary.PutUvarint(scratch[1:], n)
+	if _, err := sw.Write(scratch[:1+l]); err != nil {
+		return err
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	if _, err := bw.Write(sum[:]); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// LoadSnapshot reads a snapshot written by [Map.WriteSnapshot] from r and
+// stores its entries in the map, decoding each one with dec. The slice passed
+// to dec is only valid until dec returns. r must hold exactly one snapshot:
+// LoadSnapshot reads it to EOF.
+//
+// If the snapshot is truncated, corrupted, followed by other data or was not
+// written by WriteSnapshot, LoadSnapshot returns an error wrapping
+// [ErrCorruptSnapshot], even if dec fails on a corrupted entry. If dec fails
+// on an intact snapshot, LoadSnapshot returns dec's error, and stores none of
+// the entries after the one that failed. Entries are stored as they are read,
+// and the checksum can only be verified at the end, so after an error m may
+// hold some of the snapshot's entries: to load a snapshot all-or-nothing,
+// load it into a new Map and discard the Map on error.
+func (m *Map[K, V]) LoadSnapshot(r io.Reader, dec func([]byte) (K, V, error)) error {
+	crc := crc32.NewIEEE()
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc}
+
+	var hdr [len(snapshotMagic) + 1]byte
+	if _, err := io.ReadFull(sr, hdr[:]); err != nil {
+		return corruptSnapshot(err)
+	}
+	if string(hdr[:len(snapshotMagic)]) != snapshotMagic {
+		return fmt.Errorf("%w: bad magic number", ErrCorruptSnapshot)
+	}
+	if v := hdr[len(snapshotMagic)]; v != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrCorruptSnapshot, v)
+	}
+
+	var payload bytes.Buffer
+	var n uint64
+	// decErr is the first error returned by dec. It is only returned once
+	// the checksum shows that the entry was not corrupted, so the rest of
+	// the snapshot is read without decoding it.
+	var decErr error
+	for {
+		tag, err := sr.ReadByte()
+		if err != nil {
+			return corruptSnapshot(err)
+		}
+		if tag == snapshotEnd {
+			break
+		}
+		if tag != snapshotEntry {
+			return fmt.Errorf("%w: bad record tag %d", ErrCorruptSnapshot, tag)
+		}
+		l, err := binary.ReadUvarint(sr)
+		if err != nil {
+			return corruptSnapshot(err)
+		}
+		if l > math.MaxInt64 {
+			return fmt.Errorf("%w: record length %d out of range", ErrCorruptSnapshot, l)
+		}
+		// Copy rather than allocating l bytes up front, so that a corrupted
+		// length fails at the end of the input instead of exhausting memory.
+		payload.Reset()
+		if _, err := io.CopyN(&payload, sr, int64(l)); err != nil {
+			return corruptSnapshot(err)
+		}
+		if decErr == nil {
+			key, value, err := dec(payload.Bytes())
+			if err != nil {
+				decErr = err
+			} else {
+				m.Store(key, value)
+			}
+		}
+		n++
+	}
+
+	count, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return corruptSnapshot(err)
+	}
+	want := crc.Sum32()
+	var sum [4]byte
+	if _, err := io.ReadFull(sr.r, sum[:]); err != nil {
+		return corruptSnapshot(err)
+	}
+	if binary.BigEndian.Uint32(sum[:]) != want {
+		return fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+	if count != n {
+		return fmt.Errorf("%w: read %d entries, want %d", ErrCorruptSnapshot, n, count)
+	}
+	if _, err := sr.r.ReadByte(); err != io.EOF {
+		if err == nil {
+			return fmt.Errorf("%w: data after checksum", ErrCorruptSnapshot)
+		}
+		return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+	return decErr
+}
+
+// corruptSnapshot wraps an error from reading a snapshot in
+// ErrCorruptSnapshot, treating EOF as truncation.
+func corruptSnapshot(err error) error {
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+}
+
+// snapshotReader reads from r, adding everything it reads to crc.
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	b   [1]byte
+}
+
+func (sr *snapshotReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	sr.crc.Write(p[:n])
+	return n, err
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err == nil {
+		sr.b[0] = b
+		sr.crc.Write(sr.b[:])
+	}
+	return b, err
+}
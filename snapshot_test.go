@@ -0,0 +1,145 @@
+package sync_map_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+// encodeStringPair and decodeStringPair encode a string key and value as a
+// length-prefixed key followed by the value.
+func encodeStringPair(k, v string) ([]byte, error) {
+	b := binary.AppendUvarint(nil, uint64(len(k)))
+	b = append(b, k...)
+	return append(b, v...), nil
+}
+
+func decodeStringPair(b []byte) (string, string, error) {
+	n, l := binary.Uvarint(b)
+	if l <= 0 || n > uint64(len(b)-l) {
+		return "", "", errors.New("bad pair")
+	}
+	b = b[l:]
+	return string(b[:n]), string(b[n:]), nil
+}
+
+func writeSnapshot(t testing.TB, entries map[string]string) []byte {
+	var m sync_map.Map[string, string]
+	for k, v := range entries {
+		m.Store(k, v)
+	}
+	var buf bytes.Buffer
+	if err := m.WriteSnapshot(&buf, encodeStringPair); err != nil {
+		t.Fatalf("WriteSnapshot failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestMapSnapshotRoundTrip(t *testing.T) {
+	for _, entries := range []map[string]string{
+		{},
+		{"": ""},
+		{"a": "1", "b": "2", "c": ""},
+	} {
+		data := writeSnapshot(t, entries)
+		var m sync_map.Map[string, string]
+		if err := m.LoadSnapshot(bytes.NewReader(data), decodeStringPair); err != nil {
+			t.Fatalf("LoadSnapshot of %v failed: %v", entries, err)
+		}
+		if got := mapContents(&m); !reflect.DeepEqual(got, entries) {
+			t.Errorf("snapshot round trip of %v produced %v", entries, got)
+		}
+	}
+
+	big := map[string]string{}
+	for i := 0; i < 1<<12; i++ {
+		big[fmt.Sprint(i)] = string(make([]byte, i%100))
+	}
+	var m sync_map.Map[string, string]
+	if err := m.LoadSnapshot(bytes.NewReader(writeSnapshot(t, big)), decodeStringPair); err != nil {
+		t.Fatalf("LoadSnapshot of %v entries failed: %v", len(big), err)
+	}
+	if m.Len() != len(big) {
+		t.Errorf("LoadSnapshot loaded %v entries; want %v", m.Len(), len(big))
+	}
+}
+
+func TestMapSnapshotDetectsCorruption(t *testing.T) {
+	data := writeSnapshot(t, map[string]string{"a": "1", "b": "2", "c": "3"})
+
+	for n := 0; n < len(data); n++ {
+		var m sync_map.Map[string, string]
+		err := m.LoadSnapshot(bytes.NewReader(data[:n]), decodeStringPair)
+		if !errors.Is(err, sync_map.ErrCorruptSnapshot) {
+			t.Errorf("LoadSnapshot of snapshot truncated to %v bytes: err = %v; want ErrCorruptSnapshot", n, err)
+		}
+	}
+
+	for i := range data {
+		corrupted := bytes.Clone(data)
+		corrupted[i] ^= 0x10
+		var m sync_map.Map[string, string]
+		// A flipped bit in an entry may make dec fail before the checksum is
+		// read; that must still be reported as corruption.
+		if err := m.LoadSnapshot(bytes.NewReader(corrupted), decodeStringPair); !errors.Is(err, sync_map.ErrCorruptSnapshot) {
+			t.Errorf("LoadSnapshot after flipping a bit in byte %v: err = %v; want ErrCorruptSnapshot", i, err)
+		}
+	}
+
+	for _, tail := range [][]byte{{0}, []byte("garbage"), data} {
+		var m sync_map.Map[string, string]
+		err := m.LoadSnapshot(bytes.NewReader(append(bytes.Clone(data), tail...)), decodeStringPair)
+		if !errors.Is(err, sync_map.ErrCorruptSnapshot) {
+			t.Errorf("LoadSnapshot of snapshot followed by %q: err = %v; want ErrCorruptSnapshot", tail, err)
+		}
+	}
+}
+
+func TestMapSnapshotErrors(t *testing.T) {
+	encErr := errors.New("enc failed")
+	var m sync_map.Map[string, string]
+	m.Store("a", "1")
+	err := m.WriteSnapshot(new(bytes.Buffer), func(string, string) ([]byte, error) {
+		return nil, encErr
+	})
+	if err != encErr {
+		t.Errorf("WriteSnapshot with failing enc: err = %v; want %v", err, encErr)
+	}
+
+	decErr := errors.New("dec failed")
+	data := writeSnapshot(t, map[string]string{"a": "1"})
+	err = m.LoadSnapshot(bytes.NewReader(data), func([]byte) (string, string, error) {
+		return "", "", decErr
+	})
+	if err != decErr {
+		t.Errorf("LoadSnapshot with failing dec: err = %v; want %v", err, decErr)
+	}
+}
+
+func FuzzLoadSnapshot(f *testing.F) {
+	f.Add(writeSnapshot(f, map[string]string{}))
+	f.Add(writeSnapshot(f, map[string]string{"a": "1"}))
+	f.Add(writeSnapshot(f, map[string]string{"a": "1", "bb": "22", "": "empty"}))
+	f.Add([]byte("SMAP\x01\x01\xff\xff\xff\xff\xff\xff\xff\xff\x7f"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var m sync_map.Map[string, string]
+		if err := m.LoadSnapshot(bytes.NewReader(data), decodeStringPair); err != nil {
+			return
+		}
+		// Anything that loads successfully must survive another round trip.
+		entries := mapContents(&m)
+		var again sync_map.Map[string, string]
+		if err := again.LoadSnapshot(bytes.NewReader(writeSnapshot(t, entries)), decodeStringPair); err != nil {
+			t.Fatalf("reloading a loaded snapshot failed: %v", err)
+		}
+		if got := mapContents(&again); !reflect.DeepEqual(got, entries) {
+			t.Fatalf("reloading snapshot of %v produced %v", entries, got)
+		}
+	})
+}
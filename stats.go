@@ -0,0 +1,134 @@
+package sync_map
+
+import "sync/atomic"
+
+// Stats describes the internal state of a [Map], for debugging and
+// monitoring.
+//
+// The cumulative counters (Promotions, DirtyCopies, DirtyCopiedEntries and
+// SlowPaths) are only maintained by maps created with the [WithStats] option;
+// they are zero otherwise.
+type Stats struct {
+	// Len is the number of entries in the map, as reported by [Map.Len].
+	Len int
+	// ReadLen is the number of keys in the read map, including deleted keys
+	// whose entries have not been removed yet.
+	ReadLen int
+	// DirtyLen is the number of keys in the dirty map, or 0 if there is none.
+	DirtyLen int
+	// Amended reports whether the dirty map contains keys that are not in the
+	// read map.
+	Amended bool
+	// Misses is the number of misses recorded since the last promotion.
+	Misses int
+	// Expunged is the number of entries in the read map that are marked as
+	// expunged: deleted, and omitted from the dirty map.
+	Expunged int
+
+	// Promotions is the number of times the dirty map has been promoted to
+	// the read map.
+	Promotions uint64
+	// DirtyCopies is the number of times a dirty map has been created by
+	// copying the read map, and DirtyCopiedEntries is the total number of
+	// entries copied.
+	DirtyCopies        uint64
+	DirtyCopiedEntries uint64
+	// SlowPaths counts the operations that had to lock the map.
+	SlowPaths SlowPathStats
+}
+
+// SlowPathStats counts, for each method of a [Map], the calls that had to
+// lock the map. Calls to Store and Delete are counted as calls to Swap and
+// LoadAndDelete, and calls to LoadOrCompute are counted as calls to Compute.
+// Each batch of StoreMany, LoadMany and DeleteMany that locks the map is
+// counted as one call to Swap, Load and LoadAndDelete respectively.
+type SlowPathStats struct {
+	Load             uint64
+	LoadOrStore      uint64
+	LoadAndDelete    uint64
+	Swap             uint64
+	CompareAndSwap   uint64
+	CompareAndDelete uint64
+	Compute          uint64
+	Range            uint64
+}
+
+// WithStats makes the Map maintain the cumulative counters reported by
+// [Map.Stats].
+//
+// The counters are only updated while the map is locked, so they add no cost
+// to operations that do not need to lock it.
+func WithStats() Option {
+	return func(o *options) {
+		o.stats = true
+	}
+}
+
+// slowOp identifies the method that locked a Map, for SlowPathStats.
+type slowOp int
+
+const (
+	slowLoad slowOp = iota
+	slowLoadOrStore
+	slowLoadAndDelete
+	slowSwap
+	slowCompareAndSwap
+	slowCompareAndDelete
+	slowCompute
+	slowRange
+	numSlowOps
+)
+
+// mapCounters holds the counters maintained by maps created with WithStats.
+// All of the fields are guarded by the Map's mu.
+type mapCounters struct {
+	promotions  uint64
+	dirtyCopies uint64
+	dirtyCopied uint64
+	slow        [numSlowOps]uint64
+}
+
+// slowPathLocked records that op had to lock the map.
+func (m *Map[K, V]) slowPathLocked(op slowOp) {
+	if m.stats != nil {
+		m.stats.slow[op]++
+	}
+}
+
+// Stats returns a description of the map's internal state.
+//
+// Stats locks the map and is O(N) with the number of keys in the read map.
+func (m *Map[K, V]) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	read := m.loadReadOnly()
+	s := Stats{
+		Len:      m.Len(),
+		ReadLen:  len(read.m),
+		DirtyLen: len(m.dirty),
+		Amended:  read.amended,
+		Misses:   m.misses,
+	}
+	for _, e := range read.m {
+		if atomic.LoadPointer(&e.p) == expunged {
+			s.Expunged++
+		}
+	}
+	if c := m.stats; c != nil {
+		s.Promotions = c.promotions
+		s.DirtyCopies = c.dirtyCopies
+		s.DirtyCopiedEntries = c.dirtyCopied
+		s.SlowPaths = SlowPathStats{
+			Load:             c.slow[slowLoad],
+			LoadOrStore:      c.slow[slowLoadOrStore],
+			LoadAndDelete:    c.slow[slowLoadAndDelete],
+			Swap:             c.slow[slowSwap],
+			CompareAndSwap:   c.slow[slowCompareAndSwap],
+			CompareAndDelete: c.slow[slowCompareAndDelete],
+			Compute:          c.slow[slowCompute],
+			Range:            c.slow[slowRange],
+		}
+	}
+	return s
+}
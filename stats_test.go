@@ -0,0 +1,82 @@
+package sync_map_test
+
+import (
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+func TestMapStats(t *testing.T) {
+	m := sync_map.NewMap[int, int](sync_map.WithStats())
+
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+	s := m.Stats()
+	if s.Len != 10 || s.ReadLen != 0 || s.DirtyLen != 10 || !s.Amended {
+		t.Fatalf("after storing 10 keys, Stats() = %+v; want Len 10, ReadLen 0, DirtyLen 10, Amended", s)
+	}
+	if s.DirtyCopies != 1 || s.DirtyCopiedEntries != 0 || s.SlowPaths.Swap != 10 {
+		t.Fatalf("after storing 10 keys, Stats() = %+v; want 1 dirty copy of 0 entries and 10 slow Swaps", s)
+	}
+
+	// Every load misses until the dirty map is promoted.
+	for i := 0; i < 10; i++ {
+		m.Load(i)
+	}
+	s = m.Stats()
+	if s.Promotions != 1 || s.SlowPaths.Load != 10 || s.Misses != 0 || s.ReadLen != 10 || s.Amended {
+		t.Fatalf("after 10 loads, Stats() = %+v; want 1 promotion after 10 slow loads", s)
+	}
+
+	// Deleting from the read map leaves entries behind, which are expunged
+	// when the next new key copies the read map.
+	for i := 0; i < 5; i++ {
+		m.Delete(i)
+	}
+	m.Store(10, 10)
+	s = m.Stats()
+	if s.Len != 6 || s.Expunged != 5 || s.DirtyCopies != 2 || s.DirtyCopiedEntries != 5 || s.DirtyLen != 6 {
+		t.Fatalf("after deleting 5 keys and storing 1, Stats() = %+v; want Len 6, 5 expunged, 2 dirty copies of 5 entries", s)
+	}
+	if s.SlowPaths.LoadAndDelete != 0 {
+		t.Fatalf("deleting keys in the read map took the slow path %v times; want 0", s.SlowPaths.LoadAndDelete)
+	}
+
+	m.Range(func(_, _ int) bool { return true })
+	s = m.Stats()
+	if s.Promotions != 2 || s.SlowPaths.Range != 1 {
+		t.Fatalf("after Range, Stats() = %+v; want 2 promotions and 1 slow Range", s)
+	}
+}
+
+func TestMapStatsDisabled(t *testing.T) {
+	var m sync_map.Map[int, int]
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+		m.Load(i)
+	}
+	s := m.Stats()
+	if s.Len != 10 {
+		t.Errorf("Stats().Len = %v; want 10", s.Len)
+	}
+	if s.Promotions != 0 || s.DirtyCopies != 0 || s.SlowPaths != (sync_map.SlowPathStats{}) {
+		t.Errorf("Stats() = %+v; want zero counters without WithStats", s)
+	}
+}
+
+func TestShardedMapStats(t *testing.T) {
+	m := sync_map.NewShardedMap[int, int](4, hashInt, sync_map.WithStats())
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+	var swaps uint64
+	total := 0
+	for _, s := range m.ShardStats() {
+		swaps += s.SlowPaths.Swap
+		total += s.Len
+	}
+	if swaps != 100 || total != 100 {
+		t.Errorf("shards report %v slow Swaps and %v entries; want 100 and 100", swaps, total)
+	}
+}
@@ -0,0 +1,716 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.24
+
+package sync_map
+
+import (
+	"iter"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// TrieMap is like a Go map[K]V but is safe for concurrent use
+// by multiple goroutines without additional locking or coordination.
+//
+// TrieMap is a generic port of the concurrent hash-trie that backs sync.Map
+// since Go 1.24. Unlike [Map], it has no read-only and dirty halves: every
+// operation walks the trie, and writes lock only the node they modify. This
+// makes it a better fit than [Map] for workloads that frequently add or remove
+// keys, at some cost to the speed of loads in read-mostly workloads.
+//
+// Keys are hashed with [hash/maphash.Comparable].
+//
+// The zero TrieMap is empty and ready for use. A TrieMap must not be copied
+// after first use.
+type TrieMap[K comparable, V any] struct {
+	inited  atomic.Uint32
+	initMu  sync.Mutex
+	root    atomic.Pointer[trieIndirect[K, V]]
+	keyHash func(K) uint64
+}
+
+func (ht *TrieMap[K, V]) init() {
+	if ht.inited.Load() == 0 {
+		ht.initSlow(nil)
+	}
+}
+
+//go:noinline
+func (ht *TrieMap[K, V]) initSlow(keyHash func(K) uint64) {
+	ht.initMu.Lock()
+	defer ht.initMu.Unlock()
+
+	if ht.inited.Load() != 0 {
+		// Someone got to it while we were waiting.
+		return
+	}
+
+	if keyHash == nil {
+		keyHash = defaultHash[K]()
+	}
+	ht.keyHash = keyHash
+	ht.root.Store(newTrieIndirect[K, V](nil))
+	ht.inited.Store(1)
+}
+
+const (
+	// 16 children. This seems to be the sweet spot for
+	// load performance: any smaller and we lose out on
+	// 50% or more in CPU performance. Any larger and the
+	// returns are minuscule (~1% improvement for 32 children).
+	trieChildrenLog2 = 4
+	trieChildren     = 1 << trieChildrenLog2
+	trieChildrenMask = trieChildren - 1
+
+	trieHashBits = 64
+)
+
+// Load returns the value stored in the map for a key, or the zero value if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (ht *TrieMap[K, V]) Load(key K) (value V, ok bool) {
+	ht.init()
+	hash := ht.keyHash(key)
+
+	i := ht.root.Load()
+	hashShift := uint(trieHashBits)
+	for hashShift != 0 {
+		hashShift -= trieChildrenLog2
+
+		n := i.children[(hash>>hashShift)&trieChildrenMask].Load()
+		if n == nil {
+			return value, false
+		}
+		if n.isEntry {
+			return n.entry().lookup(key)
+		}
+		i = n.indirect()
+	}
+	panic("sync_map.TrieMap: ran out of hash bits while iterating")
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (ht *TrieMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	ht.init()
+	hash := ht.keyHash(key)
+	var i *trieIndirect[K, V]
+	var hashShift uint
+	var slot *atomic.Pointer[trieNode[K, V]]
+	var n *trieNode[K, V]
+	for {
+		// Find the key or a candidate location for insertion.
+		i = ht.root.Load()
+		hashShift = trieHashBits
+		haveInsertPoint := false
+		for hashShift != 0 {
+			hashShift -= trieChildrenLog2
+
+			slot = &i.children[(hash>>hashShift)&trieChildrenMask]
+			n = slot.Load()
+			if n == nil {
+				// We found a nil slot which is a candidate for insertion.
+				haveInsertPoint = true
+				break
+			}
+			if n.isEntry {
+				// We found an existing entry, which is as far as we can go.
+				// If it stays this way, we'll have to replace it with an
+				// indirect node.
+				if v, ok := n.entry().lookup(key); ok {
+					return v, true
+				}
+				haveInsertPoint = true
+				break
+			}
+			i = n.indirect()
+		}
+		if !haveInsertPoint {
+			panic("sync_map.TrieMap: ran out of hash bits while iterating")
+		}
+
+		// Grab the lock and double-check what we saw.
+		i.mu.Lock()
+		n = slot.Load()
+		if (n == nil || n.isEntry) && !i.dead.Load() {
+			// What we saw is still true, so we can continue with the insert.
+			break
+		}
+		// We have to start over.
+		i.mu.Unlock()
+	}
+	// N.B. This lock is held from when we broke out of the outer loop above.
+	// We specifically break this out so that we can use defer here safely.
+	// One option is to break this out into a new function instead, but
+	// there's so much local iteration state used below that this turns out
+	// to be cleaner.
+	defer i.mu.Unlock()
+
+	var oldEntry *trieEntry[K, V]
+	if n != nil {
+		oldEntry = n.entry()
+		if v, ok := oldEntry.lookup(key); ok {
+			// Easy case: by loading again, it turns out exactly what we wanted is here!
+			return v, true
+		}
+	}
+	newEntry := newTrieEntry(key, value)
+	if oldEntry == nil {
+		// Easy case: create a new entry and store it.
+		slot.Store(&newEntry.trieNode)
+	} else {
+		// We possibly need to expand the entry already there into one or more new nodes.
+		//
+		// Publish the node last, which will make both oldEntry and newEntry visible. We
+		// don't want readers to be able to observe that oldEntry isn't in the tree.
+		slot.Store(ht.expand(oldEntry, newEntry, hash, hashShift, i))
+	}
+	return value, false
+}
+
+// expand takes oldEntry and newEntry whose hashes conflict from the top bit
+// down to hashShift and produces a subtree of indirect nodes to hold the two
+// new entries.
+func (ht *TrieMap[K, V]) expand(oldEntry, newEntry *trieEntry[K, V], newHash uint64, hashShift uint, parent *trieIndirect[K, V]) *trieNode[K, V] {
+	// Check for a hash collision.
+	oldHash := ht.keyHash(oldEntry.key)
+	if oldHash == newHash {
+		// Store the old entry in the new entry's overflow list, then store
+		// the new entry.
+		newEntry.overflow.Store(oldEntry)
+		return &newEntry.trieNode
+	}
+	// We have to add an indirect node. Worse still, we may need to add more than one.
+	newIndirect := newTrieIndirect(parent)
+	top := newIndirect
+	for {
+		if hashShift == 0 {
+			panic("sync_map.TrieMap: ran out of hash bits while inserting")
+		}
+		hashShift -= trieChildrenLog2 // hashShift is for the level parent is at. We need to go deeper.
+		oi := (oldHash >> hashShift) & trieChildrenMask
+		ni := (newHash >> hashShift) & trieChildrenMask
+		if oi != ni {
+			newIndirect.children[oi].Store(&oldEntry.trieNode)
+			newIndirect.children[ni].Store(&newEntry.trieNode)
+			break
+		}
+		nextIndirect := newTrieIndirect(newIndirect)
+		newIndirect.children[oi].Store(&nextIndirect.trieNode)
+		newIndirect = nextIndirect
+	}
+	return &top.trieNode
+}
+
+// Store sets the value for a key.
+func (ht *TrieMap[K, V]) Store(key K, value V) {
+	_, _ = ht.Swap(key, value)
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (ht *TrieMap[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	ht.init()
+	hash := ht.keyHash(key)
+	var i *trieIndirect[K, V]
+	var hashShift uint
+	var slot *atomic.Pointer[trieNode[K, V]]
+	var n *trieNode[K, V]
+	for {
+		// Find the key or a candidate location for insertion.
+		i = ht.root.Load()
+		hashShift = trieHashBits
+		haveInsertPoint := false
+		for hashShift != 0 {
+			hashShift -= trieChildrenLog2
+
+			slot = &i.children[(hash>>hashShift)&trieChildrenMask]
+			n = slot.Load()
+			if n == nil || n.isEntry {
+				// We found a nil slot which is a candidate for insertion,
+				// or an existing entry that we'll replace.
+				haveInsertPoint = true
+				break
+			}
+			i = n.indirect()
+		}
+		if !haveInsertPoint {
+			panic("sync_map.TrieMap: ran out of hash bits while iterating")
+		}
+
+		// Grab the lock and double-check what we saw.
+		i.mu.Lock()
+		n = slot.Load()
+		if (n == nil || n.isEntry) && !i.dead.Load() {
+			// What we saw is still true, so we can continue with the insert.
+			break
+		}
+		// We have to start over.
+		i.mu.Unlock()
+	}
+	// N.B. This lock is held from when we broke out of the outer loop above.
+	// We specifically break this out so that we can use defer here safely.
+	// One option is to break this out into a new function instead, but
+	// there's so much local iteration state used below that this turns out
+	// to be cleaner.
+	defer i.mu.Unlock()
+
+	var oldEntry *trieEntry[K, V]
+	if n != nil {
+		// Swap if the keys compare.
+		oldEntry = n.entry()
+		newEntry, old, swapped := oldEntry.swap(key, value)
+		if swapped {
+			slot.Store(&newEntry.trieNode)
+			return old, true
+		}
+	}
+	// The keys didn't compare, so we're doing an insertion.
+	newEntry := newTrieEntry(key, value)
+	if oldEntry == nil {
+		// Easy case: create a new entry and store it.
+		slot.Store(&newEntry.trieNode)
+	} else {
+		// We possibly need to expand the entry already there into one or more new nodes.
+		//
+		// Publish the node last, which will make both oldEntry and newEntry visible. We
+		// don't want readers to be able to observe that oldEntry isn't in the tree.
+		slot.Store(ht.expand(oldEntry, newEntry, hash, hashShift, i))
+	}
+	return previous, false
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if any.
+// The loaded result reports whether the key was present.
+func (ht *TrieMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	ht.init()
+	hash := ht.keyHash(key)
+
+	// Find a node with the key and compare with it. n != nil if we found the node.
+	i, hashShift, slot, n := ht.find(key, hash, nil)
+	if n == nil {
+		if i != nil {
+			i.mu.Unlock()
+		}
+		return value, false
+	}
+
+	// Try to delete the entry.
+	v, e, loaded := n.entry().loadAndDelete(key)
+	if !loaded {
+		// Nothing was actually deleted, which means the node is no longer there.
+		i.mu.Unlock()
+		return value, false
+	}
+	if e != nil {
+		// We didn't actually delete the whole entry, just one entry in the chain.
+		// Nothing else to do, since the parent is definitely not empty.
+		slot.Store(&e.trieNode)
+		i.mu.Unlock()
+		return v, true
+	}
+	// Delete the entry.
+	slot.Store(nil)
+	ht.pruneLocked(i, hash, hashShift)
+	return v, true
+}
+
+// Delete deletes the value for a key.
+func (ht *TrieMap[K, V]) Delete(key K) {
+	_, _ = ht.LoadAndDelete(key)
+}
+
+// pruneLocked removes i from the trie if it is now empty (and isn't the root),
+// then does the same for each of its ancestors in turn. It unlocks i.mu, which
+// the caller must hold, before returning.
+func (ht *TrieMap[K, V]) pruneLocked(i *trieIndirect[K, V], hash uint64, hashShift uint) {
+	for i.parent != nil && i.empty() {
+		if hashShift == trieHashBits {
+			panic("sync_map.TrieMap: ran out of hash bits while iterating")
+		}
+		hashShift += trieChildrenLog2
+
+		// Delete the current node in the parent.
+		parent := i.parent
+		parent.mu.Lock()
+		i.dead.Store(true)
+		parent.children[(hash>>hashShift)&trieChildrenMask].Store(nil)
+		i.mu.Unlock()
+		i = parent
+	}
+	i.mu.Unlock()
+}
+
+// find searches the tree for a node that contains key (hash must be the hash
+// of key). If match != nil, then it will also enforce that match reports true
+// for the value stored for key.
+//
+// Returns a non-nil node, which will always be an entry, if found.
+//
+// If i != nil then i.mu is locked, and it is the caller's responsibility to
+// unlock it.
+func (ht *TrieMap[K, V]) find(key K, hash uint64, match func(V) bool) (i *trieIndirect[K, V], hashShift uint, slot *atomic.Pointer[trieNode[K, V]], n *trieNode[K, V]) {
+	for {
+		// Find the key or return if it's not there.
+		i = ht.root.Load()
+		hashShift = trieHashBits
+		found := false
+		for hashShift != 0 {
+			hashShift -= trieChildrenLog2
+
+			slot = &i.children[(hash>>hashShift)&trieChildrenMask]
+			n = slot.Load()
+			if n == nil {
+				// Nothing to compare with. Give up.
+				i = nil
+				return
+			}
+			if n.isEntry {
+				// We found an entry. Check if it matches.
+				if _, ok := n.entry().lookupWithValue(key, match); !ok {
+					// No match, comparison failed.
+					i = nil
+					n = nil
+					return
+				}
+				// We've got a match. Prepare to perform an operation on the key.
+				found = true
+				break
+			}
+			i = n.indirect()
+		}
+		if !found {
+			panic("sync_map.TrieMap: ran out of hash bits while iterating")
+		}
+
+		// Grab the lock and double-check what we saw.
+		i.mu.Lock()
+		n = slot.Load()
+		if !i.dead.Load() && (n == nil || n.isEntry) {
+			// Either we've got a valid node or the node is now nil under the lock.
+			// In either case, we're done here.
+			return
+		}
+		// We have to start over.
+		i.mu.Unlock()
+	}
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// Range does not necessarily correspond to any consistent snapshot of the
+// TrieMap's contents: no key will be visited more than once, but if the value
+// for any key is stored or deleted concurrently (including by f), Range may
+// reflect any mapping for that key from any point during the Range call.
+// Range does not block other methods on the receiver; even f itself may call
+// any method on ht.
+func (ht *TrieMap[K, V]) Range(f func(key K, value V) bool) {
+	ht.init()
+	ht.iter(ht.root.Load(), f)
+}
+
+// All returns an iterator over each key and value present in the map.
+//
+// The iterator has the same semantics as [TrieMap.Range].
+func (ht *TrieMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		ht.Range(yield)
+	}
+}
+
+func (ht *TrieMap[K, V]) iter(i *trieIndirect[K, V], yield func(key K, value V) bool) bool {
+	for j := range i.children {
+		n := i.children[j].Load()
+		if n == nil {
+			continue
+		}
+		if !n.isEntry {
+			if !ht.iter(n.indirect(), yield) {
+				return false
+			}
+			continue
+		}
+		e := n.entry()
+		for e != nil {
+			if !yield(e.key, e.value) {
+				return false
+			}
+			e = e.overflow.Load()
+		}
+	}
+	return true
+}
+
+// Clear deletes all the entries, resulting in an empty TrieMap.
+func (ht *TrieMap[K, V]) Clear() {
+	ht.init()
+
+	// It's sufficient to just drop the root on the floor, but the root
+	// must always be non-nil.
+	ht.root.Store(newTrieIndirect[K, V](nil))
+}
+
+// TrieCompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+// The old value must be of a comparable type.
+//
+// It is the [TrieMap] counterpart of [CompareAndSwap].
+func TrieCompareAndSwap[K comparable, V comparable](ht *TrieMap[K, V], key K, old, new V) (swapped bool) {
+	ht.init()
+	hash := ht.keyHash(key)
+	match := func(v V) bool { return v == old }
+
+	// Find a node with the key and compare with it. n != nil if we found the node.
+	i, _, slot, n := ht.find(key, hash, match)
+	if i != nil {
+		defer i.mu.Unlock()
+	}
+	if n == nil {
+		return false
+	}
+
+	// Try to swap the entry.
+	e, swapped := n.entry().compareAndSwap(key, new, match)
+	if !swapped {
+		// Nothing was actually swapped, which means the node is no longer there.
+		return false
+	}
+	// Store the entry back because it changed.
+	slot.Store(&e.trieNode)
+	return true
+}
+
+// TrieCompareAndDelete deletes the entry for key if its value is equal to old.
+// The old value must be of a comparable type.
+//
+// If there is no current value for key in the map, TrieCompareAndDelete
+// returns false (even if the old value is the zero value of V).
+//
+// It is the [TrieMap] counterpart of [CompareAndDelete].
+func TrieCompareAndDelete[K comparable, V comparable](ht *TrieMap[K, V], key K, old V) (deleted bool) {
+	ht.init()
+	hash := ht.keyHash(key)
+	match := func(v V) bool { return v == old }
+
+	// Find a node with the key. n != nil if we found the node.
+	i, hashShift, slot, n := ht.find(key, hash, nil)
+	if n == nil {
+		if i != nil {
+			i.mu.Unlock()
+		}
+		return false
+	}
+
+	// Try to delete the entry.
+	e, deleted := n.entry().compareAndDelete(key, match)
+	if !deleted {
+		// Nothing was actually deleted, which means the node is no longer there.
+		i.mu.Unlock()
+		return false
+	}
+	if e != nil {
+		// We didn't actually delete the whole entry, just one entry in the chain.
+		// Nothing else to do, since the parent is definitely not empty.
+		slot.Store(&e.trieNode)
+		i.mu.Unlock()
+		return true
+	}
+	// Delete the entry.
+	slot.Store(nil)
+	ht.pruneLocked(i, hash, hashShift)
+	return true
+}
+
+// trieIndirect is an internal node in the hash-trie.
+type trieIndirect[K comparable, V any] struct {
+	trieNode[K, V]
+	dead     atomic.Bool
+	mu       sync.Mutex // Protects mutation to children and any children that are entry nodes.
+	parent   *trieIndirect[K, V]
+	children [trieChildren]atomic.Pointer[trieNode[K, V]]
+}
+
+func newTrieIndirect[K comparable, V any](parent *trieIndirect[K, V]) *trieIndirect[K, V] {
+	return &trieIndirect[K, V]{trieNode: trieNode[K, V]{isEntry: false}, parent: parent}
+}
+
+func (i *trieIndirect[K, V]) empty() bool {
+	for j := range i.children {
+		if i.children[j].Load() != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// trieEntry is a leaf node in the hash-trie.
+type trieEntry[K comparable, V any] struct {
+	trieNode[K, V]
+	overflow atomic.Pointer[trieEntry[K, V]] // Overflow for hash collisions.
+	key      K
+	value    V
+}
+
+func newTrieEntry[K comparable, V any](key K, value V) *trieEntry[K, V] {
+	return &trieEntry[K, V]{
+		trieNode: trieNode[K, V]{isEntry: true},
+		key:      key,
+		value:    value,
+	}
+}
+
+func (e *trieEntry[K, V]) lookup(key K) (V, bool) {
+	for e != nil {
+		if e.key == key {
+			return e.value, true
+		}
+		e = e.overflow.Load()
+	}
+	return *new(V), false
+}
+
+// lookupWithValue is like lookup, but if match != nil it also requires that
+// match reports true for the value stored for key.
+func (e *trieEntry[K, V]) lookupWithValue(key K, match func(V) bool) (V, bool) {
+	for e != nil {
+		if e.key == key && (match == nil || match(e.value)) {
+			return e.value, true
+		}
+		e = e.overflow.Load()
+	}
+	return *new(V), false
+}
+
+// swap replaces an entry in the overflow chain if keys compare equal. Returns
+// the new entry chain, the old value, and whether or not anything was swapped.
+//
+// swap must be called under the mutex of the indirect node which head is a
+// child of.
+func (head *trieEntry[K, V]) swap(key K, new V) (*trieEntry[K, V], V, bool) {
+	if head.key == key {
+		// Return the new head of the list.
+		e := newTrieEntry(key, new)
+		if chain := head.overflow.Load(); chain != nil {
+			e.overflow.Store(chain)
+		}
+		return e, head.value, true
+	}
+	i := &head.overflow
+	e := i.Load()
+	for e != nil {
+		if e.key == key {
+			eNew := newTrieEntry(key, new)
+			eNew.overflow.Store(e.overflow.Load())
+			i.Store(eNew)
+			return head, e.value, true
+		}
+		i = &e.overflow
+		e = e.overflow.Load()
+	}
+	var zero V
+	return head, zero, false
+}
+
+// compareAndSwap replaces an entry in the overflow chain if the key compares
+// equal and match reports true for its value. Returns the new entry chain and
+// whether or not anything was swapped.
+//
+// compareAndSwap must be called under the mutex of the indirect node which
+// head is a child of.
+func (head *trieEntry[K, V]) compareAndSwap(key K, new V, match func(V) bool) (*trieEntry[K, V], bool) {
+	if head.key == key && match(head.value) {
+		// Return the new head of the list.
+		e := newTrieEntry(key, new)
+		if chain := head.overflow.Load(); chain != nil {
+			e.overflow.Store(chain)
+		}
+		return e, true
+	}
+	i := &head.overflow
+	e := i.Load()
+	for e != nil {
+		if e.key == key && match(e.value) {
+			eNew := newTrieEntry(key, new)
+			eNew.overflow.Store(e.overflow.Load())
+			i.Store(eNew)
+			return head, true
+		}
+		i = &e.overflow
+		e = e.overflow.Load()
+	}
+	return head, false
+}
+
+// loadAndDelete deletes an entry in the overflow chain by key. Returns the
+// value for the key, the new entry chain and whether or not anything was
+// loaded (and deleted).
+//
+// loadAndDelete must be called under the mutex of the indirect node which
+// head is a child of.
+func (head *trieEntry[K, V]) loadAndDelete(key K) (V, *trieEntry[K, V], bool) {
+	if head.key == key {
+		// Drop the head of the list.
+		return head.value, head.overflow.Load(), true
+	}
+	i := &head.overflow
+	e := i.Load()
+	for e != nil {
+		if e.key == key {
+			i.Store(e.overflow.Load())
+			return e.value, head, true
+		}
+		i = &e.overflow
+		e = e.overflow.Load()
+	}
+	return *new(V), head, false
+}
+
+// compareAndDelete deletes an entry in the overflow chain if the key compares
+// equal and match reports true for its value. Returns the new entry chain and
+// whether or not anything was deleted.
+//
+// compareAndDelete must be called under the mutex of the indirect node which
+// head is a child of.
+func (head *trieEntry[K, V]) compareAndDelete(key K, match func(V) bool) (*trieEntry[K, V], bool) {
+	if head.key == key && match(head.value) {
+		// Drop the head of the list.
+		return head.overflow.Load(), true
+	}
+	i := &head.overflow
+	e := i.Load()
+	for e != nil {
+		if e.key == key && match(e.value) {
+			i.Store(e.overflow.Load())
+			return head, true
+		}
+		i = &e.overflow
+		e = e.overflow.Load()
+	}
+	return head, false
+}
+
+// trieNode is the header for a node. It's polymorphic and
+// is actually either a trieEntry or a trieIndirect.
+type trieNode[K comparable, V any] struct {
+	isEntry bool
+}
+
+func (n *trieNode[K, V]) entry() *trieEntry[K, V] {
+	if !n.isEntry {
+		panic("sync_map.TrieMap: called entry on non-entry node")
+	}
+	return (*trieEntry[K, V])(unsafe.Pointer(n))
+}
+
+func (n *trieNode[K, V]) indirect() *trieIndirect[K, V] {
+	if n.isEntry {
+		panic("sync_map.TrieMap: called indirect on entry node")
+	}
+	return (*trieIndirect[K, V])(unsafe.Pointer(n))
+}
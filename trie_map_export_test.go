@@ -0,0 +1,11 @@
+//go:build go1.24
+
+package sync_map
+
+// NewTrieMapWithHash returns a TrieMap that hashes keys with keyHash, so that
+// tests can force hash collisions.
+func NewTrieMapWithHash[K comparable, V any](keyHash func(K) uint64) *TrieMap[K, V] {
+	ht := new(TrieMap[K, V])
+	ht.initSlow(keyHash)
+	return ht
+}
@@ -0,0 +1,186 @@
+//go:build go1.24
+
+package sync_map_test
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+	"testing/quick"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+var (
+	_ casMapInterface    = &CasTrieMap[any, any]{}
+	_ casMapInterfaceInt = &CasTrieMap[int, int]{}
+)
+
+func init() {
+	benchMaps = append(benchMaps,
+		benchImpl{"TrieMap[any,any]", func() casMapInterface { return &CasTrieMap[any, any]{} }})
+	benchMapsInt = append(benchMapsInt,
+		benchImplInt{"TrieMap[int,int]", func() casMapInterfaceInt { return &CasTrieMap[int, int]{} }})
+}
+
+type CasTrieMap[K comparable, V comparable] struct {
+	sync_map.TrieMap[K, V]
+}
+
+func (c *CasTrieMap[K, V]) CompareAndSwap(key K, old, new V) (swapped bool) {
+	return sync_map.TrieCompareAndSwap(&c.TrieMap, key, old, new)
+}
+
+func (c *CasTrieMap[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
+	return sync_map.TrieCompareAndDelete(&c.TrieMap, key, old)
+}
+
+func applyTrieMap(calls []mapCall) ([]mapResult, map[any]any) {
+	return applyCalls(new(CasTrieMap[any, any]), calls)
+}
+
+func TestTrieMapMatchesRWMutex(t *testing.T) {
+	if err := quick.CheckEqual(applyTrieMap, applyRWMutexMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTrieMapMatchesDeepCopy(t *testing.T) {
+	if err := quick.CheckEqual(applyTrieMap, applyDeepCopyMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTrieMapCollisions(t *testing.T) {
+	// There are only 4 distinct hashes, differing in their low bits, so every
+	// key collides outright with 15 others, and the 4 groups of colliding
+	// keys share long prefixes in the trie.
+	m := sync_map.NewTrieMapWithHash[int, int](func(k int) uint64 {
+		return uint64(k % 4)
+	})
+	const n = 64
+	for i := 0; i < n; i++ {
+		if _, loaded := m.LoadOrStore(i, i); loaded {
+			t.Fatalf("LoadOrStore(%v) loaded a value for a new key", i)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if v, ok := m.Load(i); !ok || v != i {
+			t.Fatalf("Load(%v) = %v, %v; want %v, true", i, v, ok, i)
+		}
+	}
+	for i := 0; i < n; i += 2 {
+		if prev, loaded := m.Swap(i, -i); !loaded || prev != i {
+			t.Fatalf("Swap(%v) = %v, %v; want %v, true", i, prev, loaded, i)
+		}
+	}
+	for i := 0; i < n; i += 3 {
+		want := i
+		if i%2 == 0 {
+			want = -i
+		}
+		if !sync_map.TrieCompareAndDelete(m, i, want) {
+			t.Fatalf("TrieCompareAndDelete(%v, %v) failed", i, want)
+		}
+	}
+	for i := 1; i < n; i += 3 {
+		m.Delete(i)
+	}
+
+	seen := 0
+	m.Range(func(k, v int) bool {
+		if k%3 != 2 {
+			t.Errorf("Range visited deleted key %v", k)
+		}
+		if (k%2 == 0 && v != -k) || (k%2 != 0 && v != k) {
+			t.Errorf("Range visited %v with unexpected value %v", k, v)
+		}
+		seen++
+		return true
+	})
+	if want := n / 3; seen != want {
+		t.Errorf("Range visited %v keys; want %v", seen, want)
+	}
+}
+
+func TestTrieMapConcurrentRange(t *testing.T) {
+	const mapSize = 1 << 10
+
+	m := new(sync_map.TrieMap[int64, int64])
+	for n := int64(1); n <= mapSize; n++ {
+		m.Store(n, int64(n))
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+	for g := int64(runtime.GOMAXPROCS(0)); g > 0; g-- {
+		r := rand.New(rand.NewSource(g))
+		wg.Add(1)
+		go func(g int64) {
+			defer wg.Done()
+			for i := int64(0); ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for n := int64(1); n < mapSize; n++ {
+					if r.Int63n(mapSize) == 0 {
+						m.Store(n, n*i*g)
+					} else {
+						m.Load(n)
+					}
+				}
+			}
+		}(g)
+	}
+
+	iters := 1 << 10
+	if testing.Short() {
+		iters = 16
+	}
+	for n := iters; n > 0; n-- {
+		seen := make(map[int64]bool, mapSize)
+		for k, v := range m.All() {
+			if v%k != 0 {
+				t.Fatalf("while Storing multiples of %v, Range saw value %v", k, v)
+			}
+			if seen[k] {
+				t.Fatalf("Range visited key %v twice", k)
+			}
+			seen[k] = true
+		}
+		if len(seen) != mapSize {
+			t.Fatalf("Range visited %v elements of %v-element TrieMap", len(seen), mapSize)
+		}
+	}
+}
+
+func TestTrieMapConcurrentDelete(t *testing.T) {
+	const keys = 1 << 10
+
+	var m sync_map.TrieMap[int, int]
+	var wg sync.WaitGroup
+	for g := runtime.GOMAXPROCS(0); g > 0; g-- {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				k := g*keys + i
+				m.Store(k, i)
+				m.Delete(k)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	m.Range(func(k, v int) bool {
+		t.Errorf("after deleting every key, TrieMap contains (%v, %v)", k, v)
+		return true
+	})
+}
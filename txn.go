@@ -0,0 +1,328 @@
+package sync_map
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// locked is an arbitrary pointer that marks entries locked by a transaction.
+// Like expunged, value pointers read from the map must be compared against it
+// before casting them to *V.
+var locked = unsafe.Pointer(new(int))
+
+// A TxnMode selects how [Map.Txn] isolates a transaction from concurrent
+// operations on the map.
+type TxnMode int
+
+const (
+	// Optimistic runs the transaction without locking the map, then locks the
+	// keys it accessed and checks that the values it read are still current
+	// before applying its changes. If they are not, the transaction is run
+	// again.
+	Optimistic TxnMode = iota
+	// Pessimistic locks the map for the whole transaction, and locks each key
+	// as the transaction accesses it, so that the transaction runs once.
+	Pessimistic
+)
+
+// A TxnOption configures a call to [Map.Txn].
+type TxnOption func(*txnOptions)
+
+type txnOptions struct {
+	mode TxnMode
+}
+
+// WithTxnMode sets the mode of a transaction. The default is [Optimistic].
+func WithTxnMode(mode TxnMode) TxnOption {
+	return func(o *txnOptions) {
+		o.mode = mode
+	}
+}
+
+// maxOptimisticAttempts is the number of times Txn runs an optimistic
+// transaction before falling back to the pessimistic mode, so that a
+// transaction that keeps conflicting with concurrent operations completes.
+const maxOptimisticAttempts = 4
+
+// Txn runs f as a transaction on the map: the values that f reads with
+// [Txn.Get] and the changes that it makes with [Txn.Put] and [Txn.Delete] take
+// effect together, at a single instant, or not at all. If f returns an error,
+// none of its changes are applied and Txn returns the error; otherwise, Txn
+// applies them and returns nil.
+//
+// No operation observes part of a transaction: while Txn applies the changes,
+// operations on the keys that f accessed, including Load, wait for it to
+// finish. Operations on other keys are not affected.
+//
+// In [Optimistic] mode, the default, f runs without locking the map, and may
+// be called more than once: if a key that f read has changed by the time its
+// changes are applied, the changes are discarded and f is called again. A call
+// that is retried may have read values that were never present together, so
+// f must only use them to decide what to change or which error to return.
+// After a few retries, Txn falls back to [Pessimistic] mode.
+//
+// In [Pessimistic] mode, f is called once, with the map locked: operations
+// that need to lock the map, and operations on the keys that f has accessed,
+// wait until Txn returns.
+//
+// f must not call any method on m, and must not use tx after it returns. The
+// hooks and watchers of m are notified of each change after the transaction
+// is applied.
+func (m *Map[K, V]) Txn(f func(tx *Txn[K, V]) error, opts ...TxnOption) error {
+	var o txnOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.mode == Optimistic {
+		for attempt := 0; attempt < maxOptimisticAttempts; attempt++ {
+			tx := m.newTxn(false)
+			if err := f(tx); tx.commit(err) {
+				return err
+			}
+		}
+	}
+	return m.txnPessimistic(f)
+}
+
+// A Txn is a transaction on a [Map], passed to the function run by
+// [Map.Txn].
+type Txn[K comparable, V any] struct {
+	m           *Map[K, V]
+	pessimistic bool
+	keys        map[K]*txnKey[V]
+	order       []K // the keys in keys, in the order they were first accessed
+}
+
+// A txnKey records the accesses of a transaction to one key.
+type txnKey[V any] struct {
+	// read reports whether an optimistic transaction has loaded the key, and
+	// seen is the value pointer that it loaded, or nil if the key was absent.
+	read bool
+	seen unsafe.Pointer
+
+	// e is the entry for the key once it is locked, or nil if the key had no
+	// entry, and old is the pointer that e held before it was locked.
+	e   *entry[V]
+	old unsafe.Pointer
+
+	// write reports whether the transaction has changed the key, and new is
+	// the value it stored, or nil if it deleted the key.
+	write bool
+	new   *V
+}
+
+func (m *Map[K, V]) newTxn(pessimistic bool) *Txn[K, V] {
+	return &Txn[K, V]{
+		m:           m,
+		pessimistic: pessimistic,
+		keys:        make(map[K]*txnKey[V]),
+	}
+}
+
+// Get returns the value for key as seen by the transaction: the value stored
+// by the transaction's last Put or Delete of key, if any, or else the value
+// in the map.
+// The ok result indicates whether value was found.
+func (tx *Txn[K, V]) Get(key K) (value V, ok bool) {
+	k := tx.key(key)
+	var p unsafe.Pointer
+	switch {
+	case k.write:
+		p = unsafe.Pointer(k.new)
+	case tx.pessimistic:
+		p = k.old
+	default:
+		if !k.read {
+			v, _ := tx.m.LoadPointer(key)
+			k.read, k.seen = true, unsafe.Pointer(v)
+		}
+		p = k.seen
+	}
+	if p == nil || p == expunged {
+		return value, false
+	}
+	return *(*V)(p), true
+}
+
+// Put sets the value for key when the transaction is applied.
+func (tx *Txn[K, V]) Put(key K, value V) {
+	k := tx.key(key)
+	k.write, k.new = true, &value
+}
+
+// Delete deletes the value for key when the transaction is applied.
+func (tx *Txn[K, V]) Delete(key K) {
+	k := tx.key(key)
+	k.write, k.new = true, nil
+}
+
+// key returns the record of the transaction's accesses to key, locking the
+// key if the transaction is pessimistic and has not accessed it yet.
+func (tx *Txn[K, V]) key(key K) *txnKey[V] {
+	if k, ok := tx.keys[key]; ok {
+		return k
+	}
+	k := new(txnKey[V])
+	if tx.pessimistic {
+		k.e, k.old = tx.m.lockEntryLocked(key)
+	}
+	tx.keys[key] = k
+	tx.order = append(tx.order, key)
+	return k
+}
+
+// commit finishes an optimistic transaction whose function returned err. It
+// locks the keys that the transaction accessed and, if the values it read are
+// still current, applies its changes unless err is not nil. It reports
+// whether the values were current; if not, nothing was changed.
+func (tx *Txn[K, V]) commit(err error) (ok bool) {
+	m := tx.m
+	m.mu.Lock()
+	ok = true
+	for _, key := range tx.order {
+		k := tx.keys[key]
+		k.e, k.old = m.lockEntryLocked(key)
+		current := k.old
+		if current == expunged {
+			current = nil
+		}
+		if k.read && current != k.seen {
+			ok = false
+			break
+		}
+	}
+	if !ok || err != nil {
+		tx.unlockLocked()
+		m.mu.Unlock()
+		return ok
+	}
+	tx.applyLocked()
+	m.mu.Unlock()
+	tx.notify()
+	return true
+}
+
+func (m *Map[K, V]) txnPessimistic(f func(tx *Txn[K, V]) error) error {
+	tx := m.newTxn(true)
+	m.mu.Lock()
+	applied := false
+	defer func() {
+		// Release the keys if f returned an error or panicked.
+		if !applied {
+			tx.unlockLocked()
+			m.mu.Unlock()
+		}
+	}()
+	if err := f(tx); err != nil {
+		return err
+	}
+	tx.applyLocked()
+	applied = true
+	m.mu.Unlock()
+	tx.notify()
+	return nil
+}
+
+// lockEntryLocked marks the entry for key as locked, and returns it along with
+// the pointer it held: a value, nil or expunged. If key has no entry,
+// lockEntryLocked returns nil, nil; no other operation can add one until mu is
+// unlocked.
+func (m *Map[K, V]) lockEntryLocked(key K) (e *entry[V], old unsafe.Pointer) {
+	read := m.loadReadOnly()
+	e, ok := read.m[key]
+	if !ok && read.amended {
+		e, ok = m.dirty[key]
+	}
+	if !ok {
+		return nil, nil
+	}
+	for {
+		// Operations that do not hold mu may still update the entry until it
+		// is locked, but not after.
+		p := atomic.LoadPointer(&e.p)
+		if atomic.CompareAndSwapPointer(&e.p, p, locked) {
+			return e, p
+		}
+	}
+}
+
+// awaitTxn waits for the transaction that has locked an entry to unlock it.
+func (m *Map[K, V]) awaitTxn() {
+	m.mu.Lock()
+	m.mu.Unlock()
+}
+
+// unlockLocked restores the entries that the transaction has locked.
+func (tx *Txn[K, V]) unlockLocked() {
+	for _, key := range tx.order {
+		if k := tx.keys[key]; k.e != nil {
+			atomic.StorePointer(&k.e.p, k.old)
+		}
+	}
+}
+
+// applyLocked applies the changes of the transaction and unlocks its entries.
+func (tx *Txn[K, V]) applyLocked() {
+	m := tx.m
+	// Add entries for new keys first. Operations can only reach them through
+	// the dirty map, with mu held, so they are not visible until mu is
+	// unlocked.
+	for _, key := range tx.order {
+		k := tx.keys[key]
+		if k.e != nil || k.new == nil {
+			continue
+		}
+		read := m.loadReadOnly()
+		if !read.amended {
+			// We're adding the first new key to the dirty map.
+			// Make sure it is allocated and mark the read-only map as incomplete.
+			m.dirtyLocked()
+			m.read.Store(&readOnly[K, V]{m: read.m, amended: true})
+		}
+		k.e = new(entry[V])
+		m.dirty[key] = k.e
+	}
+
+	for _, key := range tx.order {
+		k := tx.keys[key]
+		if k.e == nil {
+			continue
+		}
+		p := k.old
+		if k.write {
+			p = unsafe.Pointer(k.new)
+			if k.old == expunged {
+				if p == nil {
+					p = expunged
+				} else {
+					// The entry was expunged, which implies that there is a
+					// non-nil dirty map and this entry is not in it.
+					m.dirty[key] = k.e
+				}
+			}
+			m.updateCount(k.old != nil && k.old != expunged, p != nil && p != expunged)
+		}
+		atomic.StorePointer(&k.e.p, p)
+	}
+}
+
+// notify reports the changes of an applied transaction to the Map's hooks,
+// watchers and waiters.
+func (tx *Txn[K, V]) notify() {
+	for _, key := range tx.order {
+		k := tx.keys[key]
+		if !k.write {
+			continue
+		}
+		var old V
+		replaced := k.old != nil && k.old != expunged
+		if replaced {
+			old = *(*V)(k.old)
+		}
+		if k.new != nil {
+			tx.m.afterStore(key, old, replaced, *k.new)
+		} else if replaced {
+			tx.m.afterDelete(key, old)
+		}
+	}
+}
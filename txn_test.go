@@ -0,0 +1,455 @@
+package sync_map_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+var txnModes = []struct {
+	name string
+	mode sync_map.TxnMode
+}{
+	{"optimistic", sync_map.Optimistic},
+	{"pessimistic", sync_map.Pessimistic},
+}
+
+func TestMapTxn(t *testing.T) {
+	for _, tm := range txnModes {
+		t.Run(tm.name, func(t *testing.T) {
+			var r hookRecorder
+			m := sync_map.NewMap[string, int](sync_map.WithHooks(r.hooks()))
+			m.Store("a", 1)
+			m.Store("b", 2)
+			m.Promote()
+			m.Delete("b")
+			m.Store("c", 3) // Expunge the deleted entry of b.
+			r.take()
+
+			err := m.Txn(func(tx *sync_map.Txn[string, int]) error {
+				a, _ := tx.Get("a")
+				if _, ok := tx.Get("b"); ok {
+					t.Errorf("Get(b) found deleted key")
+				}
+				tx.Put("b", a+10)
+				if v, ok := tx.Get("b"); !ok || v != 11 {
+					t.Errorf("Get(b) after Put = %v, %v; want 11, true", v, ok)
+				}
+				tx.Delete("a")
+				if _, ok := tx.Get("a"); ok {
+					t.Errorf("Get(a) after Delete found the key")
+				}
+				tx.Put("d", 4)
+				tx.Delete("e")
+				return nil
+			}, sync_map.WithTxnMode(tm.mode))
+			if err != nil {
+				t.Fatalf("Txn: %v", err)
+			}
+
+			want := map[string]int{"b": 11, "c": 3, "d": 4}
+			if got := mapContents(m); !reflect.DeepEqual(got, want) {
+				t.Errorf("after Txn, map holds %v; want %v", got, want)
+			}
+			if m.Len() != len(want) {
+				t.Errorf("after Txn, Len() = %v; want %v", m.Len(), len(want))
+			}
+			// Changes are reported in the order the keys were first accessed.
+			wantEvents := []string{"delete a 1", "store b 0 false 11", "store d 0 false 4"}
+			if got := r.take(); !reflect.DeepEqual(got, wantEvents) {
+				t.Errorf("hook events = %q; want %q", got, wantEvents)
+			}
+
+			errAbort := errors.New("abort")
+			err = m.Txn(func(tx *sync_map.Txn[string, int]) error {
+				tx.Put("b", 0)
+				tx.Delete("c")
+				tx.Put("e", 5)
+				return errAbort
+			}, sync_map.WithTxnMode(tm.mode))
+			if err != errAbort {
+				t.Errorf("Txn returned %v; want %v", err, errAbort)
+			}
+			if got := mapContents(m); !reflect.DeepEqual(got, want) {
+				t.Errorf("after aborted Txn, map holds %v; want %v", got, want)
+			}
+			if got := r.take(); got != nil {
+				t.Errorf("aborted Txn called hooks: %q", got)
+			}
+		})
+	}
+}
+
+func TestMapTxnPanic(t *testing.T) {
+	for _, tm := range txnModes {
+		t.Run(tm.name, func(t *testing.T) {
+			var m sync_map.Map[string, int]
+			m.Store("a", 1)
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("Txn did not propagate the panic")
+					}
+				}()
+				m.Txn(func(tx *sync_map.Txn[string, int]) error {
+					tx.Get("a")
+					tx.Put("a", 2)
+					panic("oops")
+				}, sync_map.WithTxnMode(tm.mode))
+			}()
+			// The map must be unlocked and unchanged.
+			if v, ok := m.Load("a"); !ok || v != 1 {
+				t.Errorf("after panicking Txn, Load(a) = %v, %v; want 1, true", v, ok)
+			}
+			m.Store("b", 2)
+		})
+	}
+}
+
+// TestMapTxnLoadsSeeWholeTransactions checks that lock-free loads never see
+// part of a transaction, with transactions that keep a forward and a reverse
+// key at the same version.
+func TestMapTxnLoadsSeeWholeTransactions(t *testing.T) {
+	for _, tm := range txnModes {
+		t.Run(tm.name, func(t *testing.T) {
+			var m sync_map.Map[string, int]
+			m.Store("fwd", 0)
+			m.Store("rev", 0)
+			m.Promote() // Move the keys to the read map, so that loads do not lock it.
+
+			const writers, txns = 4, 1000
+			var stop atomic.Bool
+			var wg sync.WaitGroup
+			for i := 0; i < writers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < txns; j++ {
+						m.Txn(func(tx *sync_map.Txn[string, int]) error {
+							v, _ := tx.Get("fwd")
+							tx.Put("fwd", v+1)
+							tx.Put("rev", v+1)
+							return nil
+						}, sync_map.WithTxnMode(tm.mode))
+					}
+				}()
+			}
+			var readers sync.WaitGroup
+			for _, keys := range [][2]string{{"fwd", "rev"}, {"rev", "fwd"}} {
+				keys := keys
+				readers.Add(1)
+				go func() {
+					defer readers.Done()
+					for !stop.Load() {
+						// The second key is loaded later, so it must be at
+						// least as recent as the first.
+						first, _ := m.Load(keys[0])
+						second, _ := m.Load(keys[1])
+						if second < first {
+							t.Errorf("loaded %s = %d, then %s = %d", keys[0], first, keys[1], second)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			stop.Store(true)
+			readers.Wait()
+
+			if v, _ := m.Load("fwd"); v != writers*txns {
+				t.Errorf("after %d transactions, fwd = %d", writers*txns, v)
+			}
+		})
+	}
+}
+
+func TestMapTxnTransfers(t *testing.T) {
+	for _, tm := range txnModes {
+		t.Run(tm.name, func(t *testing.T) {
+			const accounts, initial = 8, 100
+			var m sync_map.Map[int, int]
+			for i := 0; i < accounts; i++ {
+				m.Store(i, initial)
+			}
+			errInsufficient := errors.New("insufficient funds")
+
+			var wg sync.WaitGroup
+			for g := 0; g < 4; g++ {
+				wg.Add(1)
+				go func(seed int64) {
+					defer wg.Done()
+					r := rand.New(rand.NewSource(seed))
+					for j := 0; j < 500; j++ {
+						from, to, amount := r.Intn(accounts), r.Intn(accounts), r.Intn(30)
+						err := m.Txn(func(tx *sync_map.Txn[int, int]) error {
+							a, _ := tx.Get(from)
+							if a < amount {
+								return errInsufficient
+							}
+							tx.Put(from, a-amount)
+							b, _ := tx.Get(to)
+							tx.Put(to, b+amount)
+							return nil
+						}, sync_map.WithTxnMode(tm.mode))
+						if err != nil && err != errInsufficient {
+							t.Errorf("Txn: %v", err)
+						}
+					}
+				}(int64(g))
+			}
+			// Concurrent stores of the same values make transactions conflict,
+			// without changing the sum.
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					m.Compute(j%accounts, func(old int, _ bool) (int, sync_map.ComputeOp) {
+						return old, sync_map.UpdateOp
+					})
+				}
+			}()
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+
+			for running := true; running; {
+				select {
+				case <-done:
+					running = false
+				default:
+				}
+				if sum := sumValues(m.Snapshot()); sum != accounts*initial {
+					t.Fatalf("accounts sum to %d; want %d", sum, accounts*initial)
+				}
+			}
+		})
+	}
+}
+
+func sumValues(m map[int]int) int {
+	sum := 0
+	for _, v := range m {
+		sum += v
+	}
+	return sum
+}
+
+// linKeys is the number of keys in the maps whose histories are checked by
+// checkLinearizable. A linState holds the value for each key, or 0 if the key
+// is absent.
+const linKeys = 3
+
+type linState [linKeys]int
+
+// A linOp is a completed operation in a concurrent history.
+type linOp struct {
+	// start and end are the logical times at which the operation was called
+	// and returned.
+	start, end int64
+	// apply applies the operation to a sequential model of the map, and
+	// reports whether the operation's results are consistent with it.
+	apply func(s *linState) bool
+	desc  string
+}
+
+// checkLinearizable reports whether the operations of a history, starting
+// from the empty map, can be ordered so that each one takes effect at some
+// instant between its start and end.
+func checkLinearizable(ops []linOp) bool {
+	done := make([]bool, len(ops))
+	// failed records the states that have already been explored, by the set
+	// of operations applied and the resulting model.
+	failed := make(map[string]bool)
+	var search func(s linState, left int) bool
+	search = func(s linState, left int) bool {
+		if left == 0 {
+			return true
+		}
+		key := fmt.Sprint(done, s)
+		if failed[key] {
+			return false
+		}
+		// Only operations that started before any pending operation returned
+		// can take effect next.
+		minEnd := int64(1<<63 - 1)
+		for i, op := range ops {
+			if !done[i] && op.end < minEnd {
+				minEnd = op.end
+			}
+		}
+		for i, op := range ops {
+			if done[i] || op.start > minEnd {
+				continue
+			}
+			next := s
+			if !op.apply(&next) {
+				continue
+			}
+			done[i] = true
+			if search(next, left-1) {
+				return true
+			}
+			done[i] = false
+		}
+		failed[key] = true
+		return false
+	}
+	return search(linState{}, len(ops))
+}
+
+func TestCheckLinearizable(t *testing.T) {
+	store := func(start, end int64, k, v int) linOp {
+		return linOp{start, end, func(s *linState) bool { s[k] = v; return true }, ""}
+	}
+	load := func(start, end int64, k, v int) linOp {
+		return linOp{start, end, func(s *linState) bool { return s[k] == v }, ""}
+	}
+	// A load that overlaps a store may see either value.
+	if !checkLinearizable([]linOp{store(1, 4, 0, 1), load(2, 3, 0, 0), load(5, 6, 0, 1)}) {
+		t.Errorf("overlapping load rejected")
+	}
+	// A load that starts after a store returns must see it.
+	if checkLinearizable([]linOp{store(1, 2, 0, 1), load(3, 4, 0, 0)}) {
+		t.Errorf("stale load accepted")
+	}
+	// Two loads in sequence cannot see a pair of stores out of order.
+	if checkLinearizable([]linOp{
+		store(1, 2, 0, 1), store(3, 8, 1, 1),
+		load(4, 5, 1, 1), load(6, 7, 0, 0),
+	}) {
+		t.Errorf("loads of reordered stores accepted")
+	}
+}
+
+// TestMapTxnLinearizable runs short random histories of loads, swaps, deletes
+// and transactions, and checks that each of them is linearizable.
+func TestMapTxnLinearizable(t *testing.T) {
+	rounds := 300
+	if testing.Short() {
+		rounds = 50
+	}
+	const goroutines, opsPerGoroutine = 4, 6
+
+	for _, tm := range txnModes {
+		t.Run(tm.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			for round := 0; round < rounds; round++ {
+				var m sync_map.Map[int, int]
+				var clock, nextValue atomic.Int64
+				// Start with every key present in the read map, so that
+				// operations race on the lock-free paths.
+				var initial linState
+				for k := range initial {
+					initial[k] = int(nextValue.Add(1))
+					m.Store(k, initial[k])
+				}
+				m.Promote()
+				init := linOp{
+					end:   clock.Add(1),
+					apply: func(s *linState) bool { *s = initial; return true },
+				}
+
+				histories := make([][]linOp, goroutines)
+				seeds := make([]int64, goroutines)
+				for g := range seeds {
+					seeds[g] = r.Int63()
+				}
+				start := make(chan struct{})
+				var wg sync.WaitGroup
+				for g := 0; g < goroutines; g++ {
+					wg.Add(1)
+					go func(g int) {
+						defer wg.Done()
+						r := rand.New(rand.NewSource(seeds[g]))
+						<-start
+						for i := 0; i < opsPerGoroutine; i++ {
+							histories[g] = append(histories[g], runLinOp(&m, r, &clock, &nextValue, tm.mode))
+						}
+					}(g)
+				}
+				close(start)
+				wg.Wait()
+
+				ops := []linOp{init}
+				for _, h := range histories {
+					ops = append(ops, h...)
+				}
+				if !checkLinearizable(ops) {
+					var descs []string
+					for _, op := range ops[1:] {
+						descs = append(descs, fmt.Sprintf("[%d,%d] %s", op.start, op.end, op.desc))
+					}
+					t.Fatalf("history is not linearizable:\n%q", descs)
+				}
+			}
+		})
+	}
+}
+
+// runLinOp runs a random operation on m and returns it as a linOp.
+func runLinOp(m *sync_map.Map[int, int], r *rand.Rand, clock, nextValue *atomic.Int64, mode sync_map.TxnMode) linOp {
+	k, k2 := r.Intn(linKeys), r.Intn(linKeys)
+	v := int(nextValue.Add(1))
+	op := linOp{start: clock.Add(1)}
+	switch r.Intn(4) {
+	case 0:
+		got, _ := m.Load(k)
+		op.desc = fmt.Sprintf("Load(%d) = %d", k, got)
+		op.apply = func(s *linState) bool { return s[k] == got }
+	case 1:
+		prev, _ := m.Swap(k, v)
+		op.desc = fmt.Sprintf("Swap(%d, %d) = %d", k, v, prev)
+		op.apply = func(s *linState) bool {
+			ok := s[k] == prev
+			s[k] = v
+			return ok
+		}
+	case 2:
+		prev, _ := m.LoadAndDelete(k)
+		op.desc = fmt.Sprintf("LoadAndDelete(%d) = %d", k, prev)
+		op.apply = func(s *linState) bool {
+			ok := s[k] == prev
+			s[k] = 0
+			return ok
+		}
+	default:
+		// Move the value of k to k2, and store a new value for k. Abort if k
+		// is absent.
+		var got, got2 int
+		err := m.Txn(func(tx *sync_map.Txn[int, int]) error {
+			got, _ = tx.Get(k)
+			// Let other operations run between the reads, to make
+			// conflicts likely even on a single CPU.
+			runtime.Gosched()
+			got2, _ = tx.Get(k2)
+			if got == 0 {
+				return errors.New("absent")
+			}
+			tx.Put(k2, got)
+			tx.Put(k, v)
+			return nil
+		}, sync_map.WithTxnMode(mode))
+		op.desc = fmt.Sprintf("Txn(move %d to %d, store %d) read %d, %d: %v", k, k2, v, got, got2, err)
+		op.apply = func(s *linState) bool {
+			if s[k] != got || s[k2] != got2 {
+				return false
+			}
+			if err == nil {
+				s[k2] = got
+				s[k] = v
+			}
+			return true
+		}
+	}
+	op.end = clock.Add(1)
+	return op
+}
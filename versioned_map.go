@@ -0,0 +1,111 @@
+package sync_map
+
+import "sync/atomic"
+
+// VersionedMap is like a [Map], but stamps each stored value with a version,
+// for optimistic concurrency control over values of any type.
+//
+// Every store assigns a new version, greater than the version of every value
+// the key held before, including values that have since been deleted. A
+// version therefore identifies one store of one value: unlike
+// [CompareAndSwap], which compares values, [VersionedMap.StoreIfVersion]
+// fails if the key has been stored since the version was loaded, even if an
+// equal value was stored back (the ABA problem), and it works for values that
+// are not comparable.
+//
+// The zero VersionedMap is empty and ready for use. A VersionedMap must not
+// be copied after first use.
+type VersionedMap[K comparable, V any] struct {
+	m    Map[K, *versioned[V]]
+	last atomic.Uint64 // the last version assigned
+}
+
+// versioned is a value stored in a VersionedMap. It is never modified after
+// it is stored.
+type versioned[V any] struct {
+	value   V
+	version uint64
+}
+
+// Load returns the value stored in the map for a key, or the zero value if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (m *VersionedMap[K, V]) Load(key K) (value V, ok bool) {
+	value, _, ok = m.LoadVersioned(key)
+	return value, ok
+}
+
+// LoadVersioned returns the value stored in the map for a key and its
+// version, or the zero value and version 0 if no value is present.
+// The ok result indicates whether value was found in the map.
+func (m *VersionedMap[K, V]) LoadVersioned(key K) (value V, version uint64, ok bool) {
+	e, ok := m.m.Load(key)
+	if !ok {
+		return value, 0, false
+	}
+	return e.value, e.version, true
+}
+
+// Store sets the value for a key, and returns its new version.
+func (m *VersionedMap[K, V]) Store(key K, value V) (version uint64) {
+	m.m.Compute(key, func(*versioned[V], bool) (*versioned[V], ComputeOp) {
+		version = m.last.Add(1)
+		return &versioned[V]{value: value, version: version}, UpdateOp
+	})
+	return version
+}
+
+// StoreIfVersion sets the value for a key if the version of its current
+// value is version, as returned by [VersionedMap.LoadVersioned], and reports
+// whether it did. If version is 0, StoreIfVersion only sets the value if the
+// key is not present.
+func (m *VersionedMap[K, V]) StoreIfVersion(key K, value V, version uint64) (stored bool) {
+	m.m.Compute(key, func(old *versioned[V], loaded bool) (*versioned[V], ComputeOp) {
+		if stored = versionOf(old, loaded) == version; !stored {
+			return old, CancelOp
+		}
+		// Assign the version while the old value is current, so that
+		// versions only increase.
+		return &versioned[V]{value: value, version: m.last.Add(1)}, UpdateOp
+	})
+	return stored
+}
+
+// Delete deletes the value for a key.
+func (m *VersionedMap[K, V]) Delete(key K) {
+	m.m.Delete(key)
+}
+
+// DeleteIfVersion deletes the value for a key if its version is version, as
+// returned by [VersionedMap.LoadVersioned], and reports whether it did.
+func (m *VersionedMap[K, V]) DeleteIfVersion(key K, version uint64) (deleted bool) {
+	m.m.Compute(key, func(old *versioned[V], loaded bool) (*versioned[V], ComputeOp) {
+		if deleted = loaded && old.version == version; !deleted {
+			return old, CancelOp
+		}
+		return nil, DeleteOp
+	})
+	return deleted
+}
+
+func versionOf[V any](e *versioned[V], loaded bool) uint64 {
+	if !loaded {
+		return 0
+	}
+	return e.version
+}
+
+// Range calls f sequentially for each key present in the map, with its value
+// and version. If f returns false, range stops the iteration.
+//
+// Range has the same semantics as [Map.Range].
+func (m *VersionedMap[K, V]) Range(f func(key K, value V, version uint64) bool) {
+	m.m.Range(func(key K, e *versioned[V]) bool {
+		return f(key, e.value, e.version)
+	})
+}
+
+// Len returns the number of entries in the map. See [Map.Len].
+func (m *VersionedMap[K, V]) Len() int {
+	return m.m.Len()
+}
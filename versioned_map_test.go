@@ -0,0 +1,134 @@
+package sync_map_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+// config is a value type that is not comparable, so it cannot be used with
+// CompareAndSwap.
+type config struct {
+	Name string
+	Tags []string
+}
+
+func TestVersionedMap(t *testing.T) {
+	var m sync_map.VersionedMap[string, config]
+	if _, version, ok := m.LoadVersioned("a"); ok || version != 0 {
+		t.Fatalf("LoadVersioned of missing key = %v, %v; want 0, false", version, ok)
+	}
+	if !m.StoreIfVersion("a", config{Name: "a"}, 0) {
+		t.Fatalf("StoreIfVersion(a, 0) of missing key failed")
+	}
+	if m.StoreIfVersion("a", config{Name: "b"}, 0) {
+		t.Fatalf("StoreIfVersion(a, 0) of present key succeeded")
+	}
+
+	v1, ver1, ok := m.LoadVersioned("a")
+	if !ok || v1.Name != "a" || ver1 == 0 {
+		t.Fatalf("LoadVersioned(a) = %v, %v, %v", v1, ver1, ok)
+	}
+	ver2 := m.Store("a", config{Name: "a", Tags: []string{"x"}})
+	if ver2 <= ver1 {
+		t.Errorf("Store returned version %v after version %v", ver2, ver1)
+	}
+	if m.StoreIfVersion("a", config{Name: "stale"}, ver1) {
+		t.Errorf("StoreIfVersion with stale version succeeded")
+	}
+	if m.DeleteIfVersion("a", ver1) {
+		t.Errorf("DeleteIfVersion with stale version succeeded")
+	}
+	if !m.StoreIfVersion("a", config{Name: "c"}, ver2) {
+		t.Errorf("StoreIfVersion with current version failed")
+	}
+	v, ver3, _ := m.LoadVersioned("a")
+	if v.Name != "c" || ver3 <= ver2 {
+		t.Errorf("after StoreIfVersion, LoadVersioned(a) = %v, %v", v, ver3)
+	}
+
+	if !m.DeleteIfVersion("a", ver3) {
+		t.Fatalf("DeleteIfVersion with current version failed")
+	}
+	if _, ok := m.Load("a"); ok || m.Len() != 0 {
+		t.Fatalf("key present after DeleteIfVersion")
+	}
+	// Versions keep increasing after a key is deleted and stored again.
+	if ver4 := m.Store("a", config{}); ver4 <= ver3 {
+		t.Errorf("Store after delete returned version %v after version %v", ver4, ver3)
+	}
+
+	m.Store("b", config{Name: "b"})
+	got := make(map[string]string)
+	m.Range(func(key string, value config, version uint64) bool {
+		if _, ver, _ := m.LoadVersioned(key); ver != version {
+			t.Errorf("Range(%s) version %v; LoadVersioned returned %v", key, version, ver)
+		}
+		got[key] = value.Name
+		return true
+	})
+	if want := map[string]string{"a": "", "b": "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Range visited %v; want %v", got, want)
+	}
+}
+
+// TestVersionedMapDetectsABA checks that StoreIfVersion fails after a value
+// is replaced and restored, which CompareAndSwap does not detect.
+func TestVersionedMapDetectsABA(t *testing.T) {
+	var m sync_map.Map[string, int]
+	m.Store("k", 1)
+	old, _ := m.Load("k")
+	m.Store("k", 2) // A -> B
+	m.Store("k", 1) // B -> A
+	if !sync_map.CompareAndSwap(&m, "k", old, 3) {
+		t.Fatalf("CompareAndSwap failed; the ABA problem is expected to go undetected")
+	}
+
+	var vm sync_map.VersionedMap[string, config]
+	vm.Store("k", config{Name: "a", Tags: []string{"x"}})
+	value, version, _ := vm.LoadVersioned("k")
+	vm.Store("k", config{Name: "b"})
+	vm.Store("k", value)
+	if vm.StoreIfVersion("k", config{Name: "c"}, version) {
+		t.Errorf("StoreIfVersion succeeded after the value was replaced and restored")
+	}
+	if v, _ := vm.Load("k"); !reflect.DeepEqual(v, value) {
+		t.Errorf("after failed StoreIfVersion, Load(k) = %v; want %v", v, value)
+	}
+}
+
+func TestVersionedMapConcurrentIncrements(t *testing.T) {
+	const goroutines, increments = 4, 200
+	var m sync_map.VersionedMap[string, []int]
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			var lastVersion uint64
+			for i := 0; i < increments; i++ {
+				for {
+					old, version, _ := m.LoadVersioned("k")
+					if version < lastVersion {
+						t.Errorf("version went from %v to %v", lastVersion, version)
+						return
+					}
+					lastVersion = version
+					// Append to a copy: stored values must not be modified.
+					next := append(append([]int(nil), old...), g)
+					if m.StoreIfVersion("k", next, version) {
+						break
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if v, _ := m.Load("k"); len(v) != goroutines*increments {
+		t.Errorf("after %d increments, len(value) = %d", goroutines*increments, len(v))
+	}
+}
@@ -0,0 +1,103 @@
+package sync_map
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// waitRegistry holds the goroutines waiting for keys in LoadWait.
+type waitRegistry[K comparable] struct {
+	// n is the number of goroutines in LoadWait, so that stores skip looking
+	// up keys while there are none.
+	n atomic.Int64
+	// keys holds the channel for each key that goroutines are waiting for.
+	keys Map[K, *waitEntry]
+}
+
+// A waitEntry is the channel that the goroutines waiting for a key in
+// LoadWait wait on, and the number of them. Entries are never modified, so
+// that they can be replaced with Compute.
+type waitEntry struct {
+	ch      chan struct{}
+	waiters int
+}
+
+// LoadWait returns the value stored in the map for a key. If no value is
+// present, LoadWait blocks until another goroutine stores one, or until ctx
+// is done, in which case it returns ctx.Err().
+//
+// Waiting costs stores of new keys an atomic load while no goroutine is in
+// LoadWait. While goroutines are waiting, every store of a new key also looks
+// it up among the keys being waited for, which may lock.
+func (m *Map[K, V]) LoadWait(ctx context.Context, key K) (V, error) {
+	if v, ok := m.Load(key); ok {
+		return v, nil
+	}
+	waiters := m.waiters()
+	// Count this goroutine before registering it and loading the key again,
+	// so that a store that the load misses sees the count.
+	waiters.n.Add(1)
+	defer waiters.n.Add(-1)
+	for {
+		w, _ := waiters.keys.Compute(key, func(old *waitEntry, loaded bool) (*waitEntry, ComputeOp) {
+			if !loaded {
+				return &waitEntry{ch: make(chan struct{}), waiters: 1}, UpdateOp
+			}
+			return &waitEntry{ch: old.ch, waiters: old.waiters + 1}, UpdateOp
+		})
+		// A store that happened before the channel was registered did not
+		// close it, so check again.
+		if v, ok := m.Load(key); ok {
+			m.stopWaiting(key, w.ch)
+			return v, nil
+		}
+		select {
+		case <-w.ch:
+			// The key was stored, but it may have been deleted again before
+			// this goroutine could load it.
+		case <-ctx.Done():
+			m.stopWaiting(key, w.ch)
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// waiters returns the registry of goroutines in LoadWait, creating it if
+// needed.
+func (m *Map[K, V]) waiters() *waitRegistry[K] {
+	if w := m.wait.Load(); w != nil {
+		return w
+	}
+	// Set observed before any goroutine can register: a store that finds it
+	// unset skips waking waiters, but happens before the second Load of
+	// LoadWait, which then finds the value.
+	m.observed.Store(true)
+	m.wait.CompareAndSwap(nil, new(waitRegistry[K]))
+	return m.wait.Load()
+}
+
+// stopWaiting unregisters a goroutine waiting on ch for key, removing the
+// channel once it has no waiters.
+func (m *Map[K, V]) stopWaiting(key K, ch chan struct{}) {
+	m.wait.Load().keys.Compute(key, func(old *waitEntry, loaded bool) (*waitEntry, ComputeOp) {
+		if !loaded || old.ch != ch {
+			// The channel has already been closed and removed by a store.
+			return old, CancelOp
+		}
+		if old.waiters == 1 {
+			return nil, DeleteOp
+		}
+		return &waitEntry{ch: ch, waiters: old.waiters - 1}, UpdateOp
+	})
+}
+
+// wakeWaiters wakes the goroutines waiting in LoadWait for a key that has
+// just been stored.
+func (m *Map[K, V]) wakeWaiters(key K) {
+	if w := m.wait.Load(); w != nil && w.n.Load() > 0 {
+		if e, ok := w.keys.LoadAndDelete(key); ok {
+			close(e.ch)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package sync_map_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+func TestMapLoadWait(t *testing.T) {
+	var m sync_map.Map[string, int]
+	m.Store("present", 1)
+	if v, err := m.LoadWait(context.Background(), "present"); v != 1 || err != nil {
+		t.Errorf("LoadWait of present key = %v, %v; want 1, nil", v, err)
+	}
+
+	stores := map[string]func(){
+		"Store":       func() { m.Store("k", 2) },
+		"LoadOrStore": func() { m.LoadOrStore("k", 2) },
+		"Swap":        func() { m.Swap("k", 2) },
+		"Compute": func() {
+			m.Compute("k", func(int, bool) (int, sync_map.ComputeOp) { return 2, sync_map.UpdateOp })
+		},
+	}
+	for name, store := range stores {
+		m.Delete("k")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if v, err := m.LoadWait(context.Background(), "k"); v != 2 || err != nil {
+				t.Errorf("LoadWait woken by %s = %v, %v; want 2, nil", name, v, err)
+			}
+		}()
+		waitFor(t, "LoadWait to block", func() bool { return sync_map.WaitingKeys(&m) == 1 })
+		store()
+		<-done
+		if n := sync_map.WaitingKeys(&m); n != 0 {
+			t.Errorf("after %s, %d keys still have waiters", name, n)
+		}
+	}
+}
+
+func TestMapLoadWaitCancel(t *testing.T) {
+	var m sync_map.Map[string, int]
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.LoadWait(ctx, "k"); !errors.Is(err, context.Canceled) {
+				t.Errorf("LoadWait after cancel: err = %v; want context.Canceled", err)
+			}
+		}()
+	}
+	waitFor(t, "LoadWait to block", func() bool { return sync_map.WaitingKeys(&m) == 1 })
+	cancel()
+	wg.Wait()
+	if n := sync_map.WaitingKeys(&m); n != 0 {
+		t.Errorf("after cancelling every waiter, %d keys still have waiters", n)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := m.LoadWait(ctx, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("LoadWait past deadline: err = %v; want context.DeadlineExceeded", err)
+	}
+}
+
+func TestMapLoadWaitConcurrent(t *testing.T) {
+	var m sync_map.Map[int, int]
+	const keys, waitersPerKey = 64, 4
+
+	var wg sync.WaitGroup
+	for k := 0; k < keys; k++ {
+		for i := 0; i < waitersPerKey; i++ {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				if v, err := m.LoadWait(context.Background(), k); v != k || err != nil {
+					t.Errorf("LoadWait(%d) = %v, %v; want %d, nil", k, v, err, k)
+				}
+			}(k)
+		}
+	}
+	for k := 0; k < keys; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			m.Store(k, k)
+		}(k)
+	}
+	wg.Wait()
+	if n := sync_map.WaitingKeys(&m); n != 0 {
+		t.Errorf("after every key was stored, %d keys still have waiters", n)
+	}
+}
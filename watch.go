@@ -0,0 +1,312 @@
+package sync_map
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// An EventKind says how a change delivered by [Map.Watch] changed its key.
+type EventKind int
+
+const (
+	// EventStored means a value was stored for a key that had none.
+	EventStored EventKind = iota
+	// EventSwapped means the value for a key was replaced.
+	EventSwapped
+	// EventDeleted means the value for a key was removed.
+	EventDeleted
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventStored:
+		return "stored"
+	case EventSwapped:
+		return "swapped"
+	case EventDeleted:
+		return "deleted"
+	}
+	return "EventKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// An Event describes a change to the value for a key, delivered by
+// [Map.Watch].
+type Event[V any] struct {
+	Kind EventKind
+	// Old is the value before the change, or the zero value for EventStored.
+	Old V
+	// New is the value after the change, or the zero value for EventDeleted.
+	New V
+	// Dropped is the number of events dropped immediately before this one
+	// because the watcher's buffer was full.
+	Dropped int
+}
+
+// A KeyEvent is an [Event] for a given key, delivered by [Map.WatchAll].
+type KeyEvent[K comparable, V any] struct {
+	Key K
+	Event[V]
+}
+
+// A WatchOption configures a watcher created by [Map.Watch] or
+// [Map.WatchAll].
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	buffer int
+}
+
+// DefaultWatchBuffer is the number of events a watcher buffers if it is not
+// configured with [WithWatchBuffer].
+const DefaultWatchBuffer = 64
+
+// WithWatchBuffer sets the number of undelivered events that a watcher
+// buffers before it starts dropping the oldest ones. n must be at least 1.
+func WithWatchBuffer(n int) WatchOption {
+	return func(o *watchOptions) {
+		o.buffer = n
+	}
+}
+
+// Watch returns a channel that receives an [Event] for each change to the
+// value for key, until ctx is done; the channel is then closed, and all the
+// resources of the watcher are released.
+//
+// Events are delivered by the goroutine that made the change, after making
+// it, but never block it: undelivered events are buffered, and when the
+// buffer is full, the oldest buffered event is dropped, so that the most
+// recent changes are always delivered. The Dropped field of each event counts
+// the events dropped before it. See [WithWatchBuffer].
+//
+// Like the hooks of [Hooks], the events for concurrent changes to the same
+// key may be delivered in a different order from the changes themselves. A
+// watcher that needs the current value after a burst of changes should Load
+// it. To observe a value and then every change to it, call Watch before Load.
+func (m *Map[K, V]) Watch(ctx context.Context, key K, opts ...WatchOption) <-chan Event[V] {
+	ch := make(chan Event[V])
+	w := m.newWatcher(opts)
+	m.watchers().add(&key, w)
+	go func() {
+		defer close(ch)
+		defer m.watchers().remove(&key, w)
+		w.run(ctx, func(ev KeyEvent[K, V]) bool {
+			select {
+			case ch <- ev.Event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return ch
+}
+
+// WatchAll is like [Map.Watch], but delivers the events for every key in the
+// map.
+func (m *Map[K, V]) WatchAll(ctx context.Context, opts ...WatchOption) <-chan KeyEvent[K, V] {
+	ch := make(chan KeyEvent[K, V])
+	w := m.newWatcher(opts)
+	m.watchers().add(nil, w)
+	go func() {
+		defer close(ch)
+		defer m.watchers().remove(nil, w)
+		w.run(ctx, func(ev KeyEvent[K, V]) bool {
+			select {
+			case ch <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return ch
+}
+
+// watchRegistry holds the watchers of a Map.
+//
+// The watchers of each key, and those of every key, are kept in slices that
+// are replaced rather than modified, so that notify only loads them, and
+// adding or removing a watcher only copies the slice for its key. Like any
+// Map, byKey locks on lookups of keys missing from its read map, but only
+// until its newly watched keys are promoted to it.
+type watchRegistry[K comparable, V any] struct {
+	// n is the number of watchers, so that changes to a Map that has had
+	// watchers but has none now only load it.
+	n atomic.Int64
+
+	mu sync.Mutex // serializes add and remove
+	// byKey holds a []*watcher[K, V] for each watched key. Its value type
+	// cannot mention V, since a Map[K, V] holds the registry.
+	byKey Map[K, any]
+	all   atomic.Pointer[[]*watcher[K, V]]
+}
+
+// watchers returns the Map's watch registry, creating it if needed.
+func (m *Map[K, V]) watchers() *watchRegistry[K, V] {
+	if r := m.watch.Load(); r != nil {
+		return r
+	}
+	m.observed.Store(true)
+	m.watch.CompareAndSwap(nil, new(watchRegistry[K, V]))
+	return m.watch.Load()
+}
+
+// add registers w for changes to *key, or to every key if key is nil.
+func (r *watchRegistry[K, V]) add(key *K, w *watcher[K, V]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// The slices may be in use by notify, so append to a copy.
+	if key == nil {
+		var all []*watcher[K, V]
+		if p := r.all.Load(); p != nil {
+			all = *p
+		}
+		all = append(all[:len(all):len(all)], w)
+		r.all.Store(&all)
+	} else {
+		ws := r.keyWatchers(*key)
+		r.byKey.Store(*key, append(ws[:len(ws):len(ws)], w))
+	}
+	r.n.Add(1)
+}
+
+func (r *watchRegistry[K, V]) remove(key *K, w *watcher[K, V]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key == nil {
+		all := without(*r.all.Load(), w)
+		r.all.Store(&all)
+	} else if ws := r.keyWatchers(*key); len(ws) > 1 {
+		r.byKey.Store(*key, without(ws, w))
+	} else {
+		r.byKey.Delete(*key)
+	}
+	r.n.Add(-1)
+}
+
+// keyWatchers returns the watchers of key. The slice must not be modified.
+func (r *watchRegistry[K, V]) keyWatchers(key K) []*watcher[K, V] {
+	v, _ := r.byKey.Load(key)
+	ws, _ := v.([]*watcher[K, V])
+	return ws
+}
+
+// without returns a new slice holding the watchers in ws other than w.
+func without[K comparable, V any](ws []*watcher[K, V], w *watcher[K, V]) []*watcher[K, V] {
+	var rest []*watcher[K, V]
+	for _, x := range ws {
+		if x != w {
+			rest = append(rest, x)
+		}
+	}
+	return rest
+}
+
+func (r *watchRegistry[K, V]) notify(ev KeyEvent[K, V]) {
+	if r.n.Load() == 0 {
+		return
+	}
+	for _, w := range r.keyWatchers(ev.Key) {
+		w.push(ev)
+	}
+	if all := r.all.Load(); all != nil {
+		for _, w := range *all {
+			w.push(ev)
+		}
+	}
+}
+
+// watchStored and watchDeleted deliver a change to the Map's watchers, if it
+// has any.
+func (m *Map[K, V]) watchStored(key K, old V, replaced bool, new V) {
+	if r := m.watch.Load(); r != nil {
+		kind := EventStored
+		if replaced {
+			kind = EventSwapped
+		}
+		r.notify(KeyEvent[K, V]{Key: key, Event: Event[V]{Kind: kind, Old: old, New: new}})
+	}
+}
+
+func (m *Map[K, V]) watchDeleted(key K, old V) {
+	if r := m.watch.Load(); r != nil {
+		r.notify(KeyEvent[K, V]{Key: key, Event: Event[V]{Kind: EventDeleted, Old: old}})
+	}
+}
+
+// A watcher buffers the events for one call to Watch or WatchAll until its
+// goroutine delivers them.
+type watcher[K comparable, V any] struct {
+	mu     sync.Mutex
+	queue  []KeyEvent[K, V]
+	buffer int
+
+	// wake has room for one value, and receives one (unless it is already
+	// full) whenever an event is pushed, to wake up run.
+	wake chan struct{}
+}
+
+func (m *Map[K, V]) newWatcher(opts []WatchOption) *watcher[K, V] {
+	o := watchOptions{buffer: DefaultWatchBuffer}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.buffer < 1 {
+		panic("sync_map: watch buffer must be at least 1")
+	}
+	return &watcher[K, V]{
+		buffer: o.buffer,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// push adds ev to the queue, dropping the oldest event if the queue is full.
+func (w *watcher[K, V]) push(ev KeyEvent[K, V]) {
+	w.mu.Lock()
+	if len(w.queue) == w.buffer {
+		dropped := w.queue[0].Dropped + 1
+		copy(w.queue, w.queue[1:])
+		w.queue = w.queue[:len(w.queue)-1]
+		if len(w.queue) > 0 {
+			w.queue[0].Dropped += dropped
+		} else {
+			ev.Dropped += dropped
+		}
+	}
+	w.queue = append(w.queue, ev)
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued events with send until ctx is done or send fails.
+func (w *watcher[K, V]) run(ctx context.Context, send func(KeyEvent[K, V]) bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		}
+		for {
+			w.mu.Lock()
+			if len(w.queue) == 0 {
+				w.mu.Unlock()
+				break
+			}
+			ev := w.queue[0]
+			var zero KeyEvent[K, V]
+			w.queue[0] = zero
+			w.queue = w.queue[1:]
+			w.mu.Unlock()
+
+			if !send(ev) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package sync_map_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	sync_map "github.com/zolstein/sync-map"
+)
+
+// receive returns the next value from ch, failing the test if none arrives.
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v, ok := <-ch:
+		if !ok {
+			t.Fatalf("watch channel closed unexpectedly")
+		}
+		return v
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for event")
+	}
+	panic("unreachable")
+}
+
+// waitFor polls cond until it is true, failing the test if it takes too long.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMapWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var m sync_map.Map[string, int]
+	ch := m.Watch(ctx, "a")
+	m.Store("b", 1) // Not watched.
+	m.Store("a", 1)
+	m.Swap("a", 2)
+	sync_map.CompareAndSwap(&m, "a", 2, 3)
+	m.Delete("a")
+	m.Compute("a", func(int, bool) (int, sync_map.ComputeOp) { return 4, sync_map.UpdateOp })
+
+	want := []sync_map.Event[int]{
+		{Kind: sync_map.EventStored, New: 1},
+		{Kind: sync_map.EventSwapped, Old: 1, New: 2},
+		{Kind: sync_map.EventSwapped, Old: 2, New: 3},
+		{Kind: sync_map.EventDeleted, Old: 3},
+		{Kind: sync_map.EventStored, New: 4},
+	}
+	for i, w := range want {
+		if got := receive(t, ch); got != w {
+			t.Errorf("event %d = %+v; want %+v", i, got, w)
+		}
+	}
+}
+
+func TestMapWatchAll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := sync_map.NewMap[string, int]()
+	m.Store("a", 1)
+	ch := m.WatchAll(ctx)
+	m.Store("b", 2)
+	m.Clear()
+
+	if got, want := receive(t, ch), (sync_map.KeyEvent[string, int]{Key: "b", Event: sync_map.Event[int]{Kind: sync_map.EventStored, New: 2}}); got != want {
+		t.Errorf("first event = %+v; want %+v", got, want)
+	}
+	deleted := map[string]int{}
+	for i := 0; i < 2; i++ {
+		ev := receive(t, ch)
+		if ev.Kind != sync_map.EventDeleted {
+			t.Errorf("Clear delivered %v event", ev.Kind)
+		}
+		deleted[ev.Key] = ev.Old
+	}
+	if want := map[string]int{"a": 1, "b": 2}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("Clear delivered deletes of %v; want %v", deleted, want)
+	}
+}
+
+func TestMapWatchDropsOldest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var m sync_map.Map[string, int]
+	ch := m.Watch(ctx, "k", sync_map.WithWatchBuffer(2))
+	// The watcher's goroutine may take the first event off the buffer before
+	// the rest are stored, so wait for it to deliver that event.
+	m.Store("k", 0)
+	if ev := receive(t, ch); ev.New != 0 || ev.Dropped != 0 {
+		t.Fatalf("first event = %+v; want New: 0, Dropped: 0", ev)
+	}
+
+	// Fill the buffer and keep storing while the consumer is not receiving.
+	for i := 1; i <= 10; i++ {
+		m.Store("k", i)
+	}
+	// At most one event is in flight to the channel; the rest were dropped,
+	// keeping the most recent changes.
+	total := 0
+	var last sync_map.Event[int]
+	for last.New != 10 {
+		last = receive(t, ch)
+		total += 1 + last.Dropped
+	}
+	if total != 10 {
+		t.Errorf("received and dropped %d events; want 10", total)
+	}
+}
+
+func TestMapWatchCancel(t *testing.T) {
+	var m sync_map.Map[int, int]
+	ctx, cancel := context.WithCancel(context.Background())
+	var chs []<-chan sync_map.Event[int]
+	for i := 0; i < 10; i++ {
+		chs = append(chs, m.Watch(ctx, i%3))
+	}
+	all := m.WatchAll(ctx)
+	if n := sync_map.Watchers(&m); n != 11 {
+		t.Errorf("Watchers() = %d after 11 calls to Watch; want 11", n)
+	}
+
+	// Store without receiving, so that cancellation has to unblock watchers
+	// with pending events.
+	for i := 0; i < 100; i++ {
+		m.Store(i%5, i)
+	}
+	cancel()
+	for _, ch := range chs {
+		for range ch {
+		}
+	}
+	for range all {
+	}
+	waitFor(t, "watchers to be removed", func() bool { return sync_map.Watchers(&m) == 0 })
+}
+
+func TestMapWatchConcurrent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var m sync_map.Map[int, int]
+	const writers, perWriter = 4, 1000
+	ch := m.WatchAll(ctx, sync_map.WithWatchBuffer(writers*perWriter))
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				m.Store(w, i)
+			}
+		}(w)
+	}
+
+	// Nothing is dropped with a large enough buffer, and each writer's own
+	// events arrive in order.
+	next := make([]int, writers)
+	for n := 0; n < writers*perWriter; n++ {
+		ev := receive(t, ch)
+		if ev.New != next[ev.Key] || ev.Dropped != 0 {
+			t.Fatalf("event for key %d = %+v; want New: %d", ev.Key, ev.Event, next[ev.Key])
+		}
+		next[ev.Key]++
+	}
+	wg.Wait()
+}